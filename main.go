@@ -1,16 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/url"
 	"os"
+	"os/signal"
 	"regexp"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
 	_ "github.com/amacneil/dbmate/v2/pkg/driver/clickhouse"
 	_ "github.com/amacneil/dbmate/v2/pkg/driver/mysql"
 	_ "github.com/amacneil/dbmate/v2/pkg/driver/postgres"
@@ -19,8 +30,23 @@ import (
 func main() {
 	loadDotEnv()
 
+	// cancel any running command on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+
+	// export traces if configured via OTEL_* environment variables
+	shutdownTracing, err := setupTracing(ctx)
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: unable to configure tracing: %s\n", err)
+	}
+
 	app := NewApp()
-	err := app.Run(os.Args)
+	err = app.RunContext(ctx, os.Args)
+	stop()
+
+	// flush spans, even if the command was canceled
+	if shutdownErr := shutdownTracing(context.Background()); shutdownErr != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Warning: unable to export traces: %s\n", shutdownErr)
+	}
 
 	if err != nil {
 		errText := redactLogString(fmt.Sprintf("Error: %s\n", err))
@@ -56,12 +82,57 @@ func NewApp() *cli.App {
 			Value:   cli.NewStringSlice(defaultDB.MigrationsDir[0]),
 			Usage:   "specify the directory containing migration files",
 		},
+		&cli.BoolFlag{
+			Name:    "recursive",
+			EnvVars: []string{"DBMATE_RECURSIVE"},
+			Usage:   "find migrations in subdirectories of the migrations directories",
+		},
+		&cli.StringSliceFlag{
+			Name:    "ignore",
+			EnvVars: []string{"DBMATE_IGNORE"},
+			Usage:   "glob pattern for migration files or directories to skip (may be repeated)",
+		},
+		&cli.StringFlag{
+			Name:    "version-strategy",
+			EnvVars: []string{"DBMATE_VERSION_STRATEGY"},
+			Usage:   "how to choose versions for new migrations (timestamp or sequential)",
+			Value:   string(defaultDB.VersionStrategy),
+		},
+		&cli.StringFlag{
+			Name:    "version-collision",
+			EnvVars: []string{"DBMATE_VERSION_COLLISION"},
+			Usage:   "how to handle migrations in different directories with the same version (error, first or last)",
+			Value:   string(defaultDB.VersionCollision),
+		},
+		&cli.StringFlag{
+			Name:    "templates-dir",
+			EnvVars: []string{"DBMATE_TEMPLATES_DIR"},
+			Value:   defaultDB.TemplatesDir,
+			Usage:   "specify the directory containing templates for new migrations",
+		},
 		&cli.StringFlag{
 			Name:    "migrations-table",
 			EnvVars: []string{"DBMATE_MIGRATIONS_TABLE"},
 			Value:   defaultDB.MigrationsTableName,
 			Usage:   "specify the database table to record migrations in",
 		},
+		&cli.StringFlag{
+			Name:    "environment",
+			EnvVars: []string{"DBMATE_ENVIRONMENT"},
+			Usage:   "name of the current environment, such as production, used to select seeds and migrations with the env option",
+		},
+		&cli.StringFlag{
+			Name:    "seeds-dir",
+			EnvVars: []string{"DBMATE_SEEDS_DIR"},
+			Value:   defaultDB.SeedsDir,
+			Usage:   "specify the directory containing seed files",
+		},
+		&cli.StringFlag{
+			Name:    "seeds-table",
+			EnvVars: []string{"DBMATE_SEEDS_TABLE"},
+			Value:   defaultDB.SeedsTableName,
+			Usage:   "specify the database table to record applied seeds in",
+		},
 		&cli.StringFlag{
 			Name:    "schema-file",
 			Aliases: []string{"s"},
@@ -85,6 +156,44 @@ func NewApp() *cli.App {
 			Usage:   "timeout for --wait flag",
 			Value:   defaultDB.WaitTimeout,
 		},
+		&cli.DurationFlag{
+			Name:    "statement-timeout",
+			EnvVars: []string{"DBMATE_STATEMENT_TIMEOUT"},
+			Usage:   "default statement timeout for each migration (0 for none, MySQL only applies it to SELECT)",
+			Value:   defaultDB.StatementTimeout,
+		},
+		&cli.DurationFlag{
+			Name:    "lock-timeout",
+			EnvVars: []string{"DBMATE_LOCK_TIMEOUT"},
+			Usage:   "default lock timeout for each migration (0 for none)",
+			Value:   defaultDB.LockTimeout,
+		},
+		&cli.StringSliceFlag{
+			Name:    "protected",
+			EnvVars: []string{"DBMATE_PROTECTED"},
+			Usage:   "database names or hosts (glob patterns) which cannot be dropped without --force",
+		},
+		&cli.StringFlag{
+			Name:    "backup-dir",
+			EnvVars: []string{"DBMATE_BACKUP_DIR"},
+			Usage:   "back up protected databases to this directory before applying migrations",
+		},
+		&cli.StringFlag{
+			Name:    "backup-command",
+			EnvVars: []string{"DBMATE_BACKUP_COMMAND"},
+			Usage:   "shell command which writes a backup to $DBMATE_BACKUP_PATH (not required for sqlite)",
+		},
+		&cli.StringFlag{
+			Name:    "log-format",
+			EnvVars: []string{"DBMATE_LOG_FORMAT"},
+			Usage:   "output format for log messages (text or json)",
+			Value:   "text",
+		},
+		&cli.GenericFlag{
+			Name:  "hook",
+			Value: &hookSpecs{},
+			Usage: "run a SQL file or shell command at a hook point, in the form `POINT=FILE.sql` or `POINT=COMMAND`",
+		},
 	}
 
 	app.Commands = []*cli.Command{
@@ -92,9 +201,49 @@ func NewApp() *cli.App {
 			Name:    "new",
 			Aliases: []string{"n"},
 			Usage:   "Generate a new migration file",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "template",
+					Aliases: []string{"t"},
+					EnvVars: []string{"DBMATE_TEMPLATE"},
+					Usage:   "name of the template for the new migration file",
+					Value:   dbmate.DefaultTemplate,
+				},
+				&cli.StringFlag{
+					Name:    "author",
+					EnvVars: []string{"DBMATE_AUTHOR"},
+					Usage:   "author name available to templates (defaults to the current user)",
+				},
+				&cli.BoolFlag{
+					Name:  "list-templates",
+					Usage: "list the available templates and exit",
+				},
+			},
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				if c.Bool("list-templates") {
+					names, err := db.Templates()
+					if err != nil {
+						return err
+					}
+					for _, name := range names {
+						fmt.Fprintln(db.Log, name)
+					}
+					return nil
+				}
+
 				name := c.Args().First()
-				return db.NewMigration(name)
+				return db.NewMigrationWithOptions(name, dbmate.NewMigrationOptions{
+					Template: c.String("template"),
+					Author:   c.String("author"),
+				})
+			}),
+		},
+		{
+			Name:      "renumber",
+			Usage:     "Assign new sequential versions to migrations with conflicting versions",
+			ArgsUsage: "[FILE...]",
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				return db.Renumber(c.Args().Slice()...)
 			}),
 		},
 		{
@@ -106,6 +255,12 @@ func NewApp() *cli.App {
 					EnvVars: []string{"DBMATE_STRICT"},
 					Usage:   "fail if migrations would be applied out of order",
 				},
+				&cli.StringFlag{
+					Name:    "allow-out-of-order",
+					EnvVars: []string{"DBMATE_ALLOW_OUT_OF_ORDER"},
+					Usage:   "how to handle migrations older than applied migrations: apply, warn or fail",
+					Value:   string(dbmate.OutOfOrderApply),
+				},
 				&cli.BoolFlag{
 					Name:    "verbose",
 					Aliases: []string{"v"},
@@ -116,43 +271,78 @@ func NewApp() *cli.App {
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
 				db.Strict = c.Bool("strict")
 				db.Verbose = c.Bool("verbose")
-				return db.CreateAndMigrate()
+				if err := setOutOfOrderPolicy(db, c); err != nil {
+					return err
+				}
+				return db.CreateAndMigrateContext(c.Context)
 			}),
 		},
 		{
 			Name:  "create",
 			Usage: "Create database",
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
-				return db.Create()
+				return db.CreateContext(c.Context)
 			}),
 		},
 		{
 			Name:  "drop",
 			Usage: "Drop database (if it exists)",
+			Flags: []cli.Flag{
+				yesFlag(),
+				&cli.BoolFlag{
+					Name:  "force",
+					Usage: "drop the database even if it is protected",
+				},
+			},
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
-				return db.Drop()
+				db.Force = c.Bool("force")
+				if err := db.CheckProtected(); err != nil {
+					return err
+				}
+				if err := confirm(c, db, "Drop database"); err != nil {
+					return err
+				}
+				return db.DropContext(c.Context)
 			}),
 		},
 		{
 			Name:  "migrate",
 			Usage: "Migrate to the latest version",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.BoolFlag{
 					Name:    "strict",
 					EnvVars: []string{"DBMATE_STRICT"},
 					Usage:   "fail if migrations would be applied out of order",
 				},
+				&cli.StringFlag{
+					Name:    "allow-out-of-order",
+					EnvVars: []string{"DBMATE_ALLOW_OUT_OF_ORDER"},
+					Usage:   "how to handle migrations older than applied migrations: apply, warn or fail",
+					Value:   string(dbmate.OutOfOrderApply),
+				},
 				&cli.BoolFlag{
 					Name:    "verbose",
 					Aliases: []string{"v"},
 					EnvVars: []string{"DBMATE_VERBOSE"},
 					Usage:   "print the result of each statement execution",
 				},
-			},
+			}, databasesFlags()...),
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
 				db.Strict = c.Bool("strict")
 				db.Verbose = c.Bool("verbose")
-				return db.Migrate()
+				if err := setOutOfOrderPolicy(db, c); err != nil {
+					return err
+				}
+
+				if ok, err := hasDatabases(c); ok || err != nil {
+					if err != nil {
+						return err
+					}
+					_, err := forEachDatabase(c, db, true)
+					return err
+				}
+
+				return db.MigrateContext(c.Context)
 			}),
 		},
 		{
@@ -160,6 +350,7 @@ func NewApp() *cli.App {
 			Aliases: []string{"down"},
 			Usage:   "Rollback the most recent migration",
 			Flags: []cli.Flag{
+				yesFlag(),
 				&cli.BoolFlag{
 					Name:    "verbose",
 					Aliases: []string{"v"},
@@ -169,13 +360,72 @@ func NewApp() *cli.App {
 			},
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
 				db.Verbose = c.Bool("verbose")
-				return db.Rollback()
+				if err := confirm(c, db, "Roll back the most recent migration of"); err != nil {
+					return err
+				}
+				return db.RollbackContext(c.Context)
+			}),
+		},
+		{
+			Name:  "test-migrations",
+			Usage: "Check that each migration can be rolled back, using a scratch database",
+			Flags: []cli.Flag{
+				yesFlag(),
+				&cli.BoolFlag{
+					Name:    "verbose",
+					Aliases: []string{"v"},
+					EnvVars: []string{"DBMATE_VERBOSE"},
+					Usage:   "print the result of each statement execution",
+				},
+				&cli.StringFlag{
+					Name:     "scratch-url",
+					EnvVars:  []string{"DBMATE_SCRATCH_URL"},
+					Usage:    "scratch database to drop and recreate (must not be the --url database)",
+					Required: true,
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				db.Verbose = c.Bool("verbose")
+				scratchURL, err := dbmate.ParseDatabaseURL(c.String("scratch-url"))
+				if err != nil {
+					return err
+				}
+				db.ScratchURL = scratchURL
+				scratch := *db
+				scratch.DatabaseURL = scratchURL
+				if err := scratch.CheckProtected(); err != nil {
+					return err
+				}
+				if err := confirm(c, &scratch, "Drop and recreate scratch database"); err != nil {
+					return err
+				}
+				return db.TestMigrationsContext(c.Context)
+			}),
+		},
+		{
+			Name:  "seed",
+			Usage: "Apply seed files which have not yet been applied",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "reset",
+					Usage: "forget applied seeds and apply every seed again",
+				},
+				&cli.BoolFlag{
+					Name:    "verbose",
+					Aliases: []string{"v"},
+					EnvVars: []string{"DBMATE_VERBOSE"},
+					Usage:   "print the result of each statement execution",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				db.Verbose = c.Bool("verbose")
+				return db.SeedContext(c.Context, dbmate.SeedOptions{Reset: c.Bool("reset")})
 			}),
 		},
 		{
 			Name:  "status",
 			Usage: "List applied and pending migrations",
-			Flags: []cli.Flag{
+			Flags: append([]cli.Flag{
 				&cli.BoolFlag{
 					Name:  "exit-code",
 					Usage: "return 1 if there are pending migrations",
@@ -184,7 +434,7 @@ func NewApp() *cli.App {
 					Name:  "quiet",
 					Usage: "don't output any text (implies --exit-code)",
 				},
-			},
+			}, databasesFlags()...),
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
 				db.Strict = c.Bool("strict")
 				setExitCode := c.Bool("exit-code")
@@ -193,7 +443,27 @@ func NewApp() *cli.App {
 					setExitCode = true
 				}
 
-				pending, err := db.Status(quiet)
+				if ok, err := hasDatabases(c); ok || err != nil {
+					if err != nil {
+						return err
+					}
+					if quiet {
+						db.Log = io.Discard
+					}
+					results, err := forEachDatabase(c, db, false)
+					if err != nil {
+						return err
+					}
+					for _, result := range results {
+						if result.Summary.Pending > 0 && setExitCode {
+							return cli.Exit("", 1)
+						}
+					}
+
+					return nil
+				}
+
+				pending, err := db.StatusContext(c.Context, quiet)
 				if err != nil {
 					return err
 				}
@@ -205,18 +475,143 @@ func NewApp() *cli.App {
 				return nil
 			}),
 		},
+		{
+			Name:  "validate",
+			Usage: "Check all migration files for errors, without connecting to the database",
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				problems, err := db.Validate()
+				if err != nil {
+					return err
+				}
+
+				for _, problem := range problems {
+					fmt.Fprintln(db.Log, problem)
+				}
+				if len(problems) > 0 {
+					return cli.Exit(fmt.Sprintf("Found %d problems", len(problems)), 1)
+				}
+
+				return nil
+			}),
+		},
+		{
+			Name:  "lint",
+			Usage: "Check pending migrations for risky operations",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "all",
+					Usage: "check all migrations, without connecting to the database",
+				},
+				&cli.StringSliceFlag{
+					Name:    "disable",
+					EnvVars: []string{"DBMATE_LINT_DISABLE"},
+					Usage:   "disable a lint rule (may be repeated)",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				opts := dbmate.LintOptions{All: c.Bool("all")}
+				for _, name := range c.StringSlice("disable") {
+					rule, err := dbmate.ParseLintRule(name)
+					if err != nil {
+						return err
+					}
+					opts.Disabled = append(opts.Disabled, rule)
+				}
+
+				issues, err := db.LintContext(c.Context, opts)
+				if err != nil {
+					return err
+				}
+
+				for _, issue := range issues {
+					fmt.Fprintln(db.Log, issue)
+				}
+				if len(issues) > 0 {
+					return cli.Exit(fmt.Sprintf("Found %d lint issues", len(issues)), 1)
+				}
+
+				return nil
+			}),
+		},
+		{
+			Name:      "import",
+			Usage:     "Convert migrations from another tool, and record the migrations it has applied",
+			ArgsUsage: "DIR",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:     "from",
+					Usage:    "tool which created the migrations (goose, golang-migrate or flyway)",
+					Required: true,
+				},
+				&cli.StringFlag{
+					Name:  "history-table",
+					Usage: "table the other tool records applied migrations in (defaults to the tool's default)",
+				},
+				&cli.BoolFlag{
+					Name:  "no-files",
+					Usage: "don't write converted migration files",
+				},
+				&cli.BoolFlag{
+					Name:  "no-history",
+					Usage: "don't record applied migrations from the history table",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				from, err := dbmate.ParseImportSource(c.String("from"))
+				if err != nil {
+					return err
+				}
+				if c.Args().Len() != 1 {
+					return cli.Exit("Please specify the directory containing the migrations to import", 1)
+				}
+
+				return db.ImportContext(c.Context, dbmate.ImportOptions{
+					From:         from,
+					Dir:          c.Args().First(),
+					HistoryTable: c.String("history-table"),
+					SkipFiles:    c.Bool("no-files"),
+					SkipHistory:  c.Bool("no-history"),
+				})
+			}),
+		},
+		{
+			Name:  "serve",
+			Usage: "Serve migration status as Prometheus metrics and a health check",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "listen",
+					EnvVars: []string{"DBMATE_LISTEN"},
+					Usage:   "address to listen on",
+					Value:   ":9090",
+				},
+				&cli.DurationFlag{
+					Name:    "interval",
+					EnvVars: []string{"DBMATE_INTERVAL"},
+					Usage:   "time between status checks",
+					Value:   30 * time.Second,
+				},
+				&cli.BoolFlag{
+					Name:    "migrate",
+					EnvVars: []string{"DBMATE_SERVE_MIGRATE"},
+					Usage:   "apply pending migrations on each check (also reports dbmate_last_migration_duration_seconds)",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				return serve(c.Context, db, c.String("listen"), c.Duration("interval"), c.Bool("migrate"))
+			}),
+		},
 		{
 			Name:  "dump",
 			Usage: "Write the database schema to disk",
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
-				return db.DumpSchema()
+				return db.DumpSchemaContext(c.Context)
 			}),
 		},
 		{
 			Name:  "wait",
 			Usage: "Wait for the database to become available",
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
-				return db.Wait()
+				return db.WaitContext(c.Context)
 			}),
 		},
 	}
@@ -245,18 +640,284 @@ func action(f func(*dbmate.DB, *cli.Context) error) cli.ActionFunc {
 		db := dbmate.New(u)
 		db.AutoDumpSchema = !c.Bool("no-dump-schema")
 		db.MigrationsDir = c.StringSlice("migrations-dir")
+		db.Recursive = c.Bool("recursive")
+		db.IgnorePatterns = c.StringSlice("ignore")
 		db.MigrationsTableName = c.String("migrations-table")
+		db.TemplatesDir = c.String("templates-dir")
+		db.Environment = c.String("environment")
+		db.SeedsDir = c.String("seeds-dir")
+		db.SeedsTableName = c.String("seeds-table")
+		db.ProtectedDatabases = c.StringSlice("protected")
+		db.BackupDir = c.String("backup-dir")
+		db.BackupCommand = c.String("backup-command")
+		db.VersionCollision, err = dbmate.ParseCollisionPolicy(c.String("version-collision"))
+		if err != nil {
+			return err
+		}
+		db.VersionStrategy, err = dbmate.ParseVersionStrategy(c.String("version-strategy"))
+		if err != nil {
+			return err
+		}
 		db.SchemaFile = c.String("schema-file")
+		db.StatementTimeout = c.Duration("statement-timeout")
+		db.LockTimeout = c.Duration("lock-timeout")
 		db.WaitBefore = c.Bool("wait")
 		waitTimeout := c.Duration("wait-timeout")
 		if waitTimeout != 0 {
 			db.WaitTimeout = waitTimeout
 		}
+		if err := addHooks(db, *c.Generic("hook").(*hookSpecs)); err != nil {
+			return err
+		}
+		logger, err := newLogger(c.String("log-format"))
+		if err != nil {
+			return err
+		}
+		db.Logger = logger
 
 		return f(db, c)
 	}
 }
 
+// hookSpecs collects repeated --hook flags. Unlike cli.StringSliceFlag, values
+// are not split on commas, since shell commands may contain them.
+type hookSpecs []string
+
+func (h *hookSpecs) Set(value string) error {
+	*h = append(*h, value)
+	return nil
+}
+
+func (h *hookSpecs) String() string {
+	return strings.Join(*h, " ")
+}
+
+// newLogger returns the structured logger for a log format,
+// or nil for the default human readable output
+func newLogger(format string) (*slog.Logger, error) {
+	switch format {
+	case "text":
+		return nil, nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelDebug})), nil
+	default:
+		return nil, fmt.Errorf("invalid log format `%s`, expected text or json", format)
+	}
+}
+
+// addHooks registers hooks specified as POINT=FILE.sql or POINT=COMMAND
+func addHooks(db *dbmate.DB, specs []string) error {
+	for _, spec := range specs {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok || value == "" {
+			return fmt.Errorf("invalid hook `%s`, expected POINT=FILE.sql or POINT=COMMAND", spec)
+		}
+
+		hook, err := dbmate.ParseHook(name)
+		if err != nil {
+			return err
+		}
+
+		if strings.HasSuffix(value, ".sql") {
+			db.AddSQLHook(hook, value)
+		} else {
+			db.AddCommandHook(hook, value)
+		}
+	}
+
+	return nil
+}
+
+// yesFlag returns the flag to skip confirmation of destructive commands
+func yesFlag() cli.Flag {
+	return &cli.BoolFlag{
+		Name:    "yes",
+		Aliases: []string{"y"},
+		EnvVars: []string{"DBMATE_YES"},
+		Usage:   "don't ask for confirmation (required when input is not a terminal)",
+	}
+}
+
+// confirm asks the user to confirm a destructive command against the database. Confirmation
+// is skipped with --yes. If input is not a terminal, the command is refused without --yes,
+// since it cannot be confirmed.
+func confirm(c *cli.Context, db *dbmate.DB, action string) error {
+	if c.Bool("yes") {
+		return nil
+	}
+
+	target := db.DatabaseName()
+	if host := db.DatabaseHost(); host != "" {
+		target += " on " + host
+	}
+	if !isTerminal(c.App.Reader) {
+		return fmt.Errorf("input is not a terminal, use --yes to %s %s without confirmation", strings.ToLower(action), target)
+	}
+	_, _ = fmt.Fprintf(c.App.Writer, "%s %s? [y/N] ", action, target)
+
+	answer, err := bufio.NewReader(c.App.Reader).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+		return cli.Exit("Aborted", 1)
+	}
+
+	return nil
+}
+
+// isTerminal returns whether r is an interactive terminal. Readers which are not files,
+// such as in tests, are treated as terminals.
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return true
+	}
+
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// setOutOfOrderPolicy sets the out of order policy from --allow-out-of-order
+func setOutOfOrderPolicy(db *dbmate.DB, c *cli.Context) (err error) {
+	db.AllowOutOfOrder, err = dbmate.ParseOutOfOrderPolicy(c.String("allow-out-of-order"))
+	return err
+}
+
+// databasesFlags returns the flags for running a command against several databases
+func databasesFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "urls",
+			EnvVars: []string{"DBMATE_URLS"},
+			Usage:   "run against each of these database URLs, instead of --url",
+		},
+		&cli.StringFlag{
+			Name:    "urls-file",
+			EnvVars: []string{"DBMATE_URLS_FILE"},
+			Usage:   "run against each database URL in a file, one per line",
+		},
+		&cli.StringFlag{
+			Name:    "urls-query",
+			EnvVars: []string{"DBMATE_URLS_QUERY"},
+			Usage:   "run against each database URL returned by a query against --url",
+		},
+		&cli.StringSliceFlag{
+			Name:    "schemas",
+			EnvVars: []string{"DBMATE_SCHEMAS"},
+			Usage:   "run against each of these postgres schemas in the --url database",
+		},
+		&cli.StringFlag{
+			Name:    "schemas-query",
+			EnvVars: []string{"DBMATE_SCHEMAS_QUERY"},
+			Usage:   "run against each postgres schema returned by a query against --url",
+		},
+		&cli.IntFlag{
+			Name:    "parallel",
+			EnvVars: []string{"DBMATE_PARALLEL"},
+			Usage:   "maximum number of databases to process at once",
+			Value:   1,
+		},
+		&cli.BoolFlag{
+			Name:    "continue-on-error",
+			EnvVars: []string{"DBMATE_CONTINUE_ON_ERROR"},
+			Usage:   "process every database even if some fail",
+		},
+	}
+}
+
+// hasDatabases returns whether a command should run against several databases or schemas
+func hasDatabases(c *cli.Context) (bool, error) {
+	urls := c.IsSet("urls") || c.IsSet("urls-file") || c.IsSet("urls-query")
+	schemas := c.IsSet("schemas") || c.IsSet("schemas-query")
+	if urls && schemas {
+		return false, errors.New("--urls, --urls-file and --urls-query cannot be combined with --schemas or --schemas-query")
+	}
+
+	return urls || schemas, nil
+}
+
+// forEachDatabase migrates, or returns the status of, each database or schema
+func forEachDatabase(c *cli.Context, db *dbmate.DB, migrate bool) ([]dbmate.DatabaseResult, error) {
+	opts := getDatabasesOptions(c)
+	if c.IsSet("schemas") || c.IsSet("schemas-query") {
+		schemas, err := getSchemas(c, db)
+		if err != nil {
+			return nil, err
+		}
+		if migrate {
+			return db.MigrateSchemasContext(c.Context, schemas, opts)
+		}
+		return db.StatusSchemasContext(c.Context, schemas, opts)
+	}
+
+	urls, err := getDatabaseURLs(c, db)
+	if err != nil {
+		return nil, err
+	}
+	if migrate {
+		return db.MigrateDatabasesContext(c.Context, urls, opts)
+	}
+	return db.StatusDatabasesContext(c.Context, urls, opts)
+}
+
+// getSchemas returns the schemas specified by --schemas and --schemas-query
+func getSchemas(c *cli.Context, db *dbmate.DB) ([]string, error) {
+	schemas := c.StringSlice("schemas")
+	if query := c.String("schemas-query"); query != "" {
+		querySchemas, err := db.QuerySchemas(c.Context, query)
+		if err != nil {
+			return nil, err
+		}
+		schemas = append(schemas, querySchemas...)
+	}
+
+	return schemas, nil
+}
+
+// getDatabaseURLs returns the databases specified by --urls, --urls-file and --urls-query
+func getDatabaseURLs(c *cli.Context, db *dbmate.DB) ([]*url.URL, error) {
+	urls := []*url.URL{}
+	for _, value := range c.StringSlice("urls") {
+		u, err := dbmate.ParseDatabaseURL(value)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+
+	if path := c.String("urls-file"); path != "" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer dbutil.MustClose(f)
+
+		fileURLs, err := dbmate.ReadDatabaseURLs(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		urls = append(urls, fileURLs...)
+	}
+
+	if query := c.String("urls-query"); query != "" {
+		queryURLs, err := db.QueryDatabaseURLs(c.Context, query)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, queryURLs...)
+	}
+
+	return urls, nil
+}
+
+// getDatabasesOptions returns the options for running a command against several databases
+func getDatabasesOptions(c *cli.Context) dbmate.DatabasesOptions {
+	return dbmate.DatabasesOptions{
+		Parallelism:     c.Int("parallel"),
+		ContinueOnError: c.Bool("continue-on-error"),
+	}
+}
+
 // getDatabaseURL returns the current database url from cli flag or environment variable
 func getDatabaseURL(c *cli.Context) (u *url.URL, err error) {
 	// check --url flag first
@@ -0,0 +1,106 @@
+package dbmate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Error codes
+var (
+	ErrBackupFailed    = errors.New("backup failed, no migrations were applied")
+	ErrNoBackupCommand = errors.New("no backup command configured")
+)
+
+// backupNameUnsafeRegExp matches characters which are replaced in backup file names
+var backupNameUnsafeRegExp = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// backupEnabled returns true if the database should be backed up before applying migrations
+func (db *DB) backupEnabled() bool {
+	return db.BackupDir != "" && db.protectedBy() != ""
+}
+
+// backupPath returns the path of a new backup file in BackupDir. The file is named after
+// the database host and name, a hash of the URL (so that databases with the same name, such
+// as shards migrated in parallel, never share a file), and the current time. A number is
+// appended if the file already exists.
+func (db *DB) backupPath() string {
+	name := backupNameUnsafeRegExp.ReplaceAllString(filepath.Base(db.DatabaseName()), "_")
+	if name == "" || name == "." {
+		name = "database"
+	}
+	if host := db.DatabaseHost(); host != "" {
+		name = backupNameUnsafeRegExp.ReplaceAllString(host, "_") + "_" + name
+	}
+	sum := sha256.Sum256([]byte(db.DatabaseURL.Redacted()))
+	base := fmt.Sprintf("%s-%x-%s", name, sum[:4], time.Now().UTC().Format("20060102150405.000000000"))
+
+	path := filepath.Join(db.BackupDir, base+".backup")
+	for i := 2; fileExists(path); i++ {
+		path = filepath.Join(db.BackupDir, fmt.Sprintf("%s-%d.backup", base, i))
+	}
+
+	return path
+}
+
+// fileExists returns true if a file exists at path
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// backup writes a backup of the database to BackupDir. SQLite databases are copied with
+// VACUUM INTO, and other databases are backed up by running BackupCommand.
+func (db *DB) backup(ctx context.Context, sqlDB *sql.DB) error {
+	ctx, span := db.startSpan(ctx, "dbmate.backup")
+	err := db.writeBackup(ctx, sqlDB, db.backupPath())
+	endSpan(span, err)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrBackupFailed, err)
+	}
+
+	return nil
+}
+
+func (db *DB) writeBackup(ctx context.Context, sqlDB *sql.DB, path string) error {
+	if err := os.MkdirAll(db.BackupDir, 0o755); err != nil {
+		return fmt.Errorf("%w `%s`", ErrCreateDirectory, db.BackupDir)
+	}
+
+	db.logger().Info("Backing up: "+path, EventKey, EventBackup, "path", path)
+
+	if canonicalDriver(db.DatabaseURL.Scheme) == "sqlite" {
+		// VACUUM INTO writes a consistent copy, even while the database is in use
+		_, err := sqlDB.ExecContext(ctx, fmt.Sprintf("VACUUM INTO '%s'", strings.ReplaceAll(path, "'", "''")))
+		return err
+	}
+
+	if db.BackupCommand == "" {
+		return fmt.Errorf("%w for %s", ErrNoBackupCommand, db.DatabaseURL.Scheme)
+	}
+
+	cmd := shellCommand(ctx, db.BackupCommand)
+	cmd.Stdout = db.Log
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"DATABASE_URL="+db.DatabaseURL.String(),
+		"DBMATE_BACKUP_PATH="+path,
+	)
+	if err := cmd.Run(); err != nil {
+		return err
+	}
+
+	// the command must write the backup
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("backup command did not write `%s`", path)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package dbmate
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// driverAliases maps URL schemes to the canonical name of their driver, so that
+// e.g. `driver:postgres` matches postgresql:// URLs
+var driverAliases = map[string]string{
+	"postgresql": "postgres",
+	"sqlite3":    "sqlite",
+}
+
+// canonicalDriver returns the canonical driver name for a URL scheme
+func canonicalDriver(scheme string) string {
+	if name, ok := driverAliases[scheme]; ok {
+		return name
+	}
+
+	return scheme
+}
+
+// targetsDriver reports whether a migration applies to the DatabaseURL driver.
+// Migrations which cannot be parsed are kept, so that the error is reported
+// when they are applied.
+func (db *DB) targetsDriver(migration Migration) bool {
+	if db.DatabaseURL == nil || db.DatabaseURL.Scheme == "" {
+		return true
+	}
+
+	parsed, err := migration.Parse()
+	if err != nil {
+		return true
+	}
+
+	drivers := parsed.UpOptions.Drivers()
+	if len(drivers) == 0 {
+		return true
+	}
+
+	current := canonicalDriver(db.DatabaseURL.Scheme)
+	for _, driver := range drivers {
+		if canonicalDriver(driver) == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+// skipReason returns why a migration should not be applied to this database,
+// or an empty string if it should be applied
+func (db *DB) skipReason(parsed *ParsedMigration) string {
+	if envs := parsed.UpOptions.Environments(); len(envs) > 0 && !slices.Contains(envs, db.Environment) {
+		current := "no environment set"
+		if db.Environment != "" {
+			current = "current environment is " + db.Environment
+		}
+		return fmt.Sprintf("only for environment %s, %s", strings.Join(envs, ", "), current)
+	}
+
+	return ""
+}
+
+// markSkipped sets SkipReason for each pending migration which should not be applied,
+// including migrations which depend on a skipped migration. Migrations must be in
+// dependency order. Migrations which cannot be parsed are left pending, so that the
+// error is reported when they are applied.
+func (db *DB) markSkipped(migrations []Migration) {
+	indexes := migrationIndexes(migrations)
+	for i := range migrations {
+		if migrations[i].Applied {
+			migrations[i].SkipReason = ""
+			continue
+		}
+		if migrations[i].SkipReason != "" {
+			// already skipped, such as when a dependency is for another driver
+			continue
+		}
+
+		parsed, err := migrations[i].Parse()
+		if err != nil {
+			continue
+		}
+		migrations[i].SkipReason = db.skipReason(parsed)
+		if migrations[i].SkipReason == "" {
+			migrations[i].SkipReason = dependencySkipReason(migrations, indexes, i)
+		}
+	}
+}
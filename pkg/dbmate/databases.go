@@ -0,0 +1,290 @@
+package dbmate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+)
+
+// ErrDatabasesFailed is returned when a command fails against one or more databases
+var ErrDatabasesFailed = errors.New("failed for some databases")
+
+// DatabasesOptions specifies how a command runs against several databases
+type DatabasesOptions struct {
+	// Parallelism is the maximum number of databases processed at once. Defaults to 1.
+	Parallelism int
+	// ContinueOnError processes every database even if some fail. By default, no further
+	// databases are started after a failure, although those in progress are completed.
+	ContinueOnError bool
+}
+
+// DatabaseResult is the outcome of a command against one database
+type DatabaseResult struct {
+	// Name identifies the database in output, such as the redacted URL or the schema
+	Name string
+	// URL is the database connection string
+	URL *url.URL
+	// Summary is the migration status after the command, or nil if it failed
+	Summary *Summary
+	// Err is the error returned by the command
+	Err error
+	// Skipped is true if the command was not started, because another database failed
+	Skipped bool
+	// Duration is how long the command took
+	Duration time.Duration
+}
+
+// MigrateDatabases migrates each database to the latest version
+func (db *DB) MigrateDatabases(urls []*url.URL, opts DatabasesOptions) ([]DatabaseResult, error) {
+	return db.MigrateDatabasesContext(context.Background(), urls, opts)
+}
+
+// MigrateDatabasesContext migrates each database to the latest version, using a copy
+// of db with DatabaseURL replaced. The schema file is not written.
+func (db *DB) MigrateDatabasesContext(ctx context.Context, urls []*url.URL, opts DatabasesOptions) ([]DatabaseResult, error) {
+	return db.forEachDatabase(ctx, urlTargets(urls), opts, migrateTarget)
+}
+
+// StatusDatabases returns the migration status of each database
+func (db *DB) StatusDatabases(urls []*url.URL, opts DatabasesOptions) ([]DatabaseResult, error) {
+	return db.StatusDatabasesContext(context.Background(), urls, opts)
+}
+
+// StatusDatabasesContext returns the migration status of each database
+func (db *DB) StatusDatabasesContext(ctx context.Context, urls []*url.URL, opts DatabasesOptions) ([]DatabaseResult, error) {
+	return db.forEachDatabase(ctx, urlTargets(urls), opts, statusTarget)
+}
+
+// migrateTarget migrates a database, and returns its status afterwards
+func migrateTarget(ctx context.Context, target *DB) (*Summary, error) {
+	if err := target.MigrateContext(ctx); err != nil {
+		return nil, err
+	}
+
+	return target.SummaryContext(ctx)
+}
+
+// statusTarget returns the status of a database
+func statusTarget(ctx context.Context, target *DB) (*Summary, error) {
+	return target.SummaryContext(ctx)
+}
+
+// databaseTarget is a database to run a command against
+type databaseTarget struct {
+	name string
+	url  *url.URL
+}
+
+// urlTargets returns targets named by their redacted URL
+func urlTargets(urls []*url.URL) []databaseTarget {
+	targets := make([]databaseTarget, len(urls))
+	for i, u := range urls {
+		targets[i] = databaseTarget{name: u.Redacted(), url: u}
+	}
+
+	return targets
+}
+
+// forEachDatabase runs f against a copy of db for each target, with bounded parallelism.
+// Output of each database is buffered and written to Log when it completes, so that
+// the output of databases processed in parallel is not interleaved. A summary line
+// is logged for each database once all have completed.
+func (db *DB) forEachDatabase(ctx context.Context, targets []databaseTarget, opts DatabasesOptions, f func(context.Context, *DB) (*Summary, error)) ([]DatabaseResult, error) {
+	parallelism := max(opts.Parallelism, 1)
+	results := make([]DatabaseResult, len(targets))
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed bool
+	)
+	sem := make(chan struct{}, parallelism)
+
+	for i, t := range targets {
+		results[i].Name = t.name
+		results[i].URL = t.url
+
+		sem <- struct{}{}
+		mu.Lock()
+		stop := failed && !opts.ContinueOnError
+		mu.Unlock()
+		if stop || ctx.Err() != nil {
+			<-sem
+			results[i].Skipped = true
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, t databaseTarget) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			target, output := db.forDatabase(t)
+			start := time.Now()
+			summary, err := f(ctx, target)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[i].Summary = summary
+			results[i].Err = err
+			results[i].Duration = time.Since(start)
+			if err != nil {
+				failed = true
+			}
+			if output.Len() > 0 {
+				fmt.Fprintf(db.Log, "==> %s\n%s", t.name, output.String())
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	return results, db.logDatabaseResults(results)
+}
+
+// forDatabase returns a copy of db for another database. Human readable output is
+// written to the returned buffer, and structured log records include the database.
+func (db *DB) forDatabase(t databaseTarget) (*DB, *bytes.Buffer) {
+	output := &bytes.Buffer{}
+	target := *db
+	target.DatabaseURL = t.url
+	target.AutoDumpSchema = false
+	target.Log = output
+	if db.Logger != nil {
+		target.Logger = db.Logger.With("database", t.name)
+	}
+
+	return &target, output
+}
+
+// logDatabaseResults logs a line for each database, and returns ErrDatabasesFailed
+// if any database failed or was skipped
+func (db *DB) logDatabaseResults(results []DatabaseResult) error {
+	var failed, skipped int
+	if len(results) > 0 && db.Logger == nil {
+		fmt.Fprintln(db.Log)
+	}
+
+	for _, result := range results {
+		name := result.Name
+		attrs := []any{EventKey, EventDatabaseResult, "database", name, "duration", result.Duration}
+
+		switch {
+		case result.Skipped:
+			skipped++
+			db.logger().Warn(fmt.Sprintf("[skipped] %s: not started after an earlier failure", name), append(attrs, "status", "skipped")...)
+		case result.Err != nil:
+			failed++
+			db.logger().Warn(fmt.Sprintf("[failed] %s: %s", name, result.Err), append(attrs, "status", "failed", "error", result.Err.Error())...)
+		default:
+			s := result.Summary
+			line := fmt.Sprintf("[ok] %s: applied %d, pending %d", name, s.Applied, s.Pending)
+			if s.Skipped > 0 {
+				line += fmt.Sprintf(", skipped %d", s.Skipped)
+			}
+			if s.Drift() {
+				line += fmt.Sprintf(", missing %d, out of order %d", len(s.Missing), len(s.OutOfOrder))
+			}
+			db.logger().Info(line, append(attrs, "status", "ok", "applied", s.Applied, "pending", s.Pending)...)
+		}
+	}
+
+	if db.Logger == nil {
+		fmt.Fprintln(db.Log)
+		fmt.Fprintf(db.Log, "Databases: %d\n", len(results))
+		fmt.Fprintf(db.Log, "Failed: %d\n", failed)
+		if skipped > 0 {
+			fmt.Fprintf(db.Log, "Skipped: %d\n", skipped)
+		}
+	}
+
+	if failed > 0 || skipped > 0 {
+		return fmt.Errorf("%w: %d failed, %d skipped of %d", ErrDatabasesFailed, failed, skipped, len(results))
+	}
+
+	return nil
+}
+
+// ReadDatabaseURLs reads one database URL per line. Blank lines and lines
+// starting with # are ignored.
+func ReadDatabaseURLs(r io.Reader) ([]*url.URL, error) {
+	urls := []*url.URL{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		u, err := ParseDatabaseURL(line)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+
+	return urls, scanner.Err()
+}
+
+// ParseDatabaseURL parses a database URL, requiring a scheme
+func ParseDatabaseURL(value string) (*url.URL, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		// url errors include the full URL, which may contain a password
+		return nil, fmt.Errorf("%w: unable to parse database url", ErrInvalidURL)
+	}
+	if u.Scheme == "" {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidURL, u.Redacted())
+	}
+
+	return u, nil
+}
+
+// QueryDatabaseURLs runs a query against DatabaseURL which returns database URLs
+// in the first column
+func (db *DB) QueryDatabaseURLs(ctx context.Context, query string) ([]*url.URL, error) {
+	values, err := db.queryColumn(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := []*url.URL{}
+	for _, value := range values {
+		u, err := ParseDatabaseURL(value)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+
+	return urls, nil
+}
+
+// queryColumn runs a query against DatabaseURL and returns the first column
+func (db *DB) queryColumn(ctx context.Context, query string) ([]string, error) {
+	drv, err := db.DriverContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := drv.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer dbutil.MustClose(sqlDB)
+
+	values, err := dbutil.QueryColumnContext(ctx, sqlDB, query)
+	if err != nil {
+		return nil, drv.QueryError(query, err)
+	}
+
+	return values, nil
+}
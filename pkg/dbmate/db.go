@@ -1,19 +1,25 @@
 package dbmate
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
+	"log/slog"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Error codes
@@ -28,6 +34,8 @@ var (
 	ErrMigrationDirNotFound  = errors.New("could not find migrations directory")
 	ErrMigrationNotFound     = errors.New("can't find migration file")
 	ErrCreateDirectory       = errors.New("unable to create directory")
+	ErrStatementTimeout      = errors.New("statement timeout exceeded")
+	ErrLockTimeout           = errors.New("lock timeout exceeded")
 )
 
 // migrationFileRegexp pattern for valid migration files
@@ -35,30 +43,99 @@ var migrationFileRegexp = regexp.MustCompile(`^(\d+).*\.sql$`)
 
 // DB allows dbmate actions to be performed on a specified database
 type DB struct {
+	// AllowOutOfOrder specifies how pending migrations older than applied migrations are handled
+	AllowOutOfOrder OutOfOrderPolicy
 	// AutoDumpSchema generates schema.sql after each action
 	AutoDumpSchema bool
+	// BackupCommand is a shell command which backs up the database before migrating, for drivers
+	// other than SQLite. It receives DATABASE_URL, and must write the backup to DBMATE_BACKUP_PATH.
+	BackupCommand string
+	// BackupDir is the directory to write backups to before applying migrations to a database
+	// which matches ProtectedDatabases, or empty to disable backups
+	BackupDir string
 	// DatabaseURL is the database connection string
 	DatabaseURL *url.URL
+	// Environment is the name of the current environment, such as production, used to select seeds
+	// and to skip migrations whose env option does not include it
+	Environment string
 	// FS specifies the filesystem, or nil for OS filesystem
 	FS fs.FS
+	// Force allows dropping a database which matches ProtectedDatabases
+	Force bool
+	// IgnorePatterns lists glob patterns for files and directories to skip when finding
+	// migrations, matched against the base name and the path within the migrations directory
+	IgnorePatterns []string
+	// Hooks specifies callbacks to run at points in the migration lifecycle
+	Hooks map[Hook][]HookFunc
+	// LockTimeout specifies the default lock timeout for each migration, or zero for none
+	LockTimeout time.Duration
 	// Log is the interface to write stdout
 	Log io.Writer
+	// Logger receives structured log events, or nil to write human readable messages to Log
+	Logger *slog.Logger
 	// MigrationsDir specifies the directory or directories to find migration files
 	MigrationsDir []string
 	// MigrationsTableName specifies the database table to record migrations in
 	MigrationsTableName string
+	// ProtectedDatabases lists glob patterns of database names or hosts which cannot be dropped
+	// unless Force is set
+	ProtectedDatabases []string
+	// Recursive finds migrations in subdirectories of MigrationsDir
+	Recursive bool
+	// ScratchURL is the database which TestMigrations drops and recreates, which must not
+	// be the same database as DatabaseURL
+	ScratchURL *url.URL
 	// SchemaFile specifies the location for schema.sql file
 	SchemaFile string
-	// Fail if migrations would be applied out of order
+	// SeedsDir specifies the directory containing seed files
+	SeedsDir string
+	// SeedsTableName specifies the database table to record applied seeds in
+	SeedsTableName string
+	// StatementTimeout specifies the default statement timeout for each migration, or zero for none
+	StatementTimeout time.Duration
+	// Fail if migrations would be applied out of order, equivalent to AllowOutOfOrder OutOfOrderFail
 	Strict bool
+	// TemplatesDir specifies the directory containing templates for new migrations
+	TemplatesDir string
+	// TracerProvider creates OpenTelemetry spans, or nil to use the global provider
+	TracerProvider trace.TracerProvider
 	// Verbose prints the result of each statement execution
 	Verbose bool
+	// VersionCollision specifies how to handle migrations in different directories with the same version
+	VersionCollision CollisionPolicy
+	// VersionStrategy specifies how versions are chosen for new migrations
+	VersionStrategy VersionStrategy
 	// WaitBefore will wait for database to become available before running any actions
 	WaitBefore bool
 	// WaitInterval specifies length of time between connection attempts
 	WaitInterval time.Duration
 	// WaitTimeout specifies maximum time for connection attempts
 	WaitTimeout time.Duration
+	// Writer creates files such as the schema file and new migrations, and defaults to
+	// the OS filesystem (even when FS is set). Use DiscardWriter for read-only setups.
+	Writer Writer
+}
+
+// Summary is an overview of the migration status
+type Summary struct {
+	// Applied is the number of migration files applied to the database
+	Applied int
+	// Pending is the number of migration files not yet applied
+	Pending int
+	// Skipped is the number of migration files which will not be applied to this database
+	Skipped int
+	// LastApplied is the highest version applied to the database
+	LastApplied string
+	// Missing lists versions applied to the database without a migration file
+	Missing []string
+	// OutOfOrder lists pending versions lower than LastApplied
+	OutOfOrder []string
+}
+
+// Drift returns true if the database does not match the migration files,
+// ignoring migrations which are simply pending
+func (s *Summary) Drift() bool {
+	return len(s.Missing) > 0 || len(s.OutOfOrder) > 0
 }
 
 // StatusResult represents an available migration status
@@ -70,23 +147,53 @@ type StatusResult struct {
 // New initializes a new dbmate database
 func New(databaseURL *url.URL) *DB {
 	return &DB{
+		AllowOutOfOrder:     OutOfOrderApply,
 		AutoDumpSchema:      true,
+		BackupCommand:       "",
+		BackupDir:           "",
 		DatabaseURL:         databaseURL,
+		Environment:         "",
 		FS:                  nil,
+		Force:               false,
+		Hooks:               map[Hook][]HookFunc{},
+		IgnorePatterns:      nil,
+		LockTimeout:         0,
 		Log:                 os.Stdout,
+		Logger:              nil,
 		MigrationsDir:       []string{"./db/migrations"},
 		MigrationsTableName: "schema_migrations",
+		ProtectedDatabases:  nil,
+		Recursive:           false,
+		ScratchURL:          nil,
 		SchemaFile:          "./db/schema.sql",
+		SeedsDir:            "./db/seeds",
+		SeedsTableName:      "schema_seeds",
+		StatementTimeout:    0,
 		Strict:              false,
+		TemplatesDir:        "./db/templates",
+		TracerProvider:      nil,
 		Verbose:             false,
+		VersionCollision:    CollisionError,
+		VersionStrategy:     VersionTimestamp,
 		WaitBefore:          false,
 		WaitInterval:        time.Second,
 		WaitTimeout:         60 * time.Second,
+		Writer:              OSWriter{},
 	}
 }
 
 // Driver initializes the appropriate database driver
 func (db *DB) Driver() (Driver, error) {
+	return db.DriverContext(context.Background())
+}
+
+// DriverContext initializes the appropriate database driver
+func (db *DB) DriverContext(ctx context.Context) (Driver, error) {
+	return db.driver(ctx, db.MigrationsTableName)
+}
+
+// driver initializes the database driver, recording versions in the specified table
+func (db *DB) driver(ctx context.Context, tableName string) (Driver, error) {
 	if db.DatabaseURL == nil || db.DatabaseURL.Scheme == "" {
 		return nil, ErrInvalidURL
 	}
@@ -99,12 +206,13 @@ func (db *DB) Driver() (Driver, error) {
 	config := DriverConfig{
 		DatabaseURL:         db.DatabaseURL,
 		Log:                 db.Log,
-		MigrationsTableName: db.MigrationsTableName,
+		Logger:              db.logger(),
+		MigrationsTableName: tableName,
 	}
 	drv := driverFunc(config)
 
 	if db.WaitBefore {
-		if err := db.wait(drv); err != nil {
+		if err := db.wait(ctx, drv); err != nil {
 			return nil, err
 		}
 	}
@@ -112,48 +220,73 @@ func (db *DB) Driver() (Driver, error) {
 	return drv, nil
 }
 
-func (db *DB) wait(drv Driver) error {
+func (db *DB) wait(ctx context.Context, drv Driver) error {
 	// attempt connection to database server
-	err := drv.Ping()
+	err := contextDriver(drv).PingContext(ctx)
 	if err == nil {
 		// connection successful
 		return nil
 	}
 
-	fmt.Fprint(db.Log, "Waiting for database")
+	// progress dots are only written in human readable mode
+	progress := func(s string) {
+		if db.Logger == nil {
+			fmt.Fprint(db.Log, s)
+		}
+	}
+
+	if db.Logger != nil {
+		db.Logger.Info("Waiting for database", EventKey, EventWait, "error", err)
+	}
+	progress("Waiting for database")
 	for i := 0 * time.Second; i < db.WaitTimeout; i += db.WaitInterval {
-		fmt.Fprint(db.Log, ".")
-		time.Sleep(db.WaitInterval)
+		progress(".")
+		select {
+		case <-ctx.Done():
+			progress("\n")
+			return ctx.Err()
+		case <-time.After(db.WaitInterval):
+		}
 
 		// attempt connection to database server
-		err = drv.Ping()
+		err = contextDriver(drv).PingContext(ctx)
 		if err == nil {
 			// connection successful
-			fmt.Fprint(db.Log, "\n")
+			progress("\n")
 			return nil
 		}
 	}
 
 	// if we find outselves here, we could not connect within the timeout
-	fmt.Fprint(db.Log, "\n")
+	progress("\n")
 	return fmt.Errorf("%w: %s", ErrCantConnect, err)
 }
 
 // Wait blocks until the database server is available. It does not verify that
 // the specified database exists, only that the host is ready to accept connections.
 func (db *DB) Wait() error {
-	drv, err := db.Driver()
+	return db.WaitContext(context.Background())
+}
+
+// WaitContext blocks until the database server is available, or the context is canceled
+func (db *DB) WaitContext(ctx context.Context) error {
+	drv, err := db.DriverContext(ctx)
 	if err != nil {
 		return err
 	}
 
 	// if db.WaitBefore is true, wait() will get called twice, no harm
-	return db.wait(drv)
+	return db.wait(ctx, drv)
 }
 
 // CreateAndMigrate creates the database (if necessary) and runs migrations
 func (db *DB) CreateAndMigrate() error {
-	drv, err := db.Driver()
+	return db.CreateAndMigrateContext(context.Background())
+}
+
+// CreateAndMigrateContext creates the database (if necessary) and runs migrations
+func (db *DB) CreateAndMigrateContext(ctx context.Context) error {
+	drv, err := db.DriverContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -161,118 +294,139 @@ func (db *DB) CreateAndMigrate() error {
 	// create database if it does not already exist
 	// skip this step if we cannot determine status
 	// (e.g. user does not have list database permission)
-	exists, err := drv.DatabaseExists()
+	exists, err := contextDriver(drv).DatabaseExistsContext(ctx)
 	if err == nil && !exists {
-		if err := drv.CreateDatabase(); err != nil {
+		if err := contextDriver(drv).CreateDatabaseContext(ctx); err != nil {
 			return err
 		}
 	}
 
 	// migrate
-	return db.Migrate()
+	return db.MigrateContext(ctx)
 }
 
 // Create creates the current database
 func (db *DB) Create() error {
-	drv, err := db.Driver()
+	return db.CreateContext(context.Background())
+}
+
+// CreateContext creates the current database
+func (db *DB) CreateContext(ctx context.Context) error {
+	drv, err := db.DriverContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	return drv.CreateDatabase()
+	return contextDriver(drv).CreateDatabaseContext(ctx)
 }
 
 // Drop drops the current database (if it exists)
 func (db *DB) Drop() error {
-	drv, err := db.Driver()
+	return db.DropContext(context.Background())
+}
+
+// DropContext drops the current database (if it exists). Databases matching
+// ProtectedDatabases are not dropped unless Force is set.
+func (db *DB) DropContext(ctx context.Context) error {
+	if err := db.CheckProtected(); err != nil {
+		return err
+	}
+
+	drv, err := db.DriverContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	return drv.DropDatabase()
+	return contextDriver(drv).DropDatabaseContext(ctx)
 }
 
 // DumpSchema writes the current database schema to a file
 func (db *DB) DumpSchema() error {
-	drv, err := db.Driver()
+	return db.DumpSchemaContext(context.Background())
+}
+
+// DumpSchemaContext writes the current database schema to a file
+func (db *DB) DumpSchemaContext(ctx context.Context) error {
+	ctx, span := db.startSpan(ctx, "dbmate.dump_schema")
+	err := db.dumpSchema(ctx)
+	endSpan(span, err)
+
+	return err
+}
+
+func (db *DB) dumpSchema(ctx context.Context) error {
+	drv, err := db.DriverContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	sqlDB, err := db.openDatabaseForMigration(drv)
+	sqlDB, err := db.openDatabaseForMigration(ctx, drv)
 	if err != nil {
 		return err
 	}
 	defer dbutil.MustClose(sqlDB)
 
-	schema, err := drv.DumpSchema(sqlDB)
+	schema, err := contextDriver(drv).DumpSchemaContext(ctx, sqlDB)
 	if err != nil {
 		return err
 	}
 
-	fmt.Fprintf(db.Log, "Writing: %s\n", db.SchemaFile)
-
-	// ensure schema directory exists
-	if err = ensureDir(filepath.Dir(db.SchemaFile)); err != nil {
-		return err
-	}
+	db.logger().Info("Writing: "+db.SchemaFile, EventKey, EventSchemaDump, "file", db.SchemaFile)
 
-	// write schema to file
-	return os.WriteFile(db.SchemaFile, schema, 0o644)
+	// write schema to file, creating the schema directory if needed
+	return db.writeFile(db.SchemaFile, schema)
 }
 
-// ensureDir creates a directory if it does not already exist
-func ensureDir(dir string) error {
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return fmt.Errorf("%w `%s`", ErrCreateDirectory, dir)
-	}
-
-	return nil
+// NewMigration creates a new migration file using the default template
+func (db *DB) NewMigration(name string) error {
+	return db.NewMigrationWithOptions(name, NewMigrationOptions{})
 }
 
-const migrationTemplate = "-- migrate:up\n\n\n-- migrate:down\n\n"
-
-// NewMigration creates a new migration file
-func (db *DB) NewMigration(name string) error {
+// NewMigrationWithOptions creates a new migration file
+func (db *DB) NewMigrationWithOptions(name string, opts NewMigrationOptions) error {
 	// new migration name
-	timestamp := time.Now().UTC().Format("20060102150405")
 	if name == "" {
 		return ErrNoMigrationName
 	}
-	name = fmt.Sprintf("%s_%s.sql", timestamp, name)
+	version, err := db.newMigrationVersion()
+	if err != nil {
+		return err
+	}
+	contents, err := db.renderMigrationTemplate(opts.Template, newTemplateData(name, version, opts.Author))
+	if err != nil {
+		return err
+	}
+	name = fmt.Sprintf("%s_%s.sql", version, name)
 
 	// create migrations dir if missing
-	if err := ensureDir(db.MigrationsDir[0]); err != nil {
+	w := db.writer()
+	if err := db.ensureDir(w, db.MigrationsDir[0]); err != nil {
 		return err
 	}
 
 	// check file does not already exist
-	path := filepath.Join(db.MigrationsDir[0], name)
-	fmt.Fprintf(db.Log, "Creating migration: %s\n", path)
+	path := db.joinPath(db.MigrationsDir[0], name)
+	db.logger().Info("Creating migration: "+path, EventKey, EventMigrationCreate, "file", path)
 
-	if _, err := os.Stat(path); !os.IsNotExist(err) {
+	if _, err := db.stat(path); !errors.Is(err, fs.ErrNotExist) {
 		return ErrMigrationAlreadyExist
 	}
 
 	// write new migration
-	file, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-
-	defer dbutil.MustClose(file)
-	_, err = file.WriteString(migrationTemplate)
-	return err
+	return w.WriteFile(path, contents)
 }
 
-func doTransaction(sqlDB *sql.DB, txFunc func(dbutil.Transaction) error) error {
-	tx, err := sqlDB.Begin()
+func doTransaction(ctx context.Context, db interface {
+	BeginTx(context.Context, *sql.TxOptions) (*sql.Tx, error)
+}, txFunc func(dbutil.Transaction) error) error {
+	tx, err := db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
 	if err := txFunc(tx); err != nil {
-		if err1 := tx.Rollback(); err1 != nil {
+		// the transaction has already been rolled back if the context was canceled
+		if err1 := tx.Rollback(); err1 != nil && !errors.Is(err1, sql.ErrTxDone) {
 			return err1
 		}
 
@@ -282,13 +436,79 @@ func doTransaction(sqlDB *sql.DB, txFunc func(dbutil.Transaction) error) error {
 	return tx.Commit()
 }
 
-func (db *DB) openDatabaseForMigration(drv Driver) (*sql.DB, error) {
+// migrationTimeouts returns the statement and lock timeouts for a migration block,
+// falling back to the global defaults
+func (db *DB) migrationTimeouts(options ParsedMigrationOptions) (time.Duration, time.Duration) {
+	statementTimeout := options.Timeout()
+	if statementTimeout == 0 {
+		statementTimeout = db.StatementTimeout
+	}
+
+	lockTimeout := options.LockTimeout()
+	if lockTimeout == 0 {
+		lockTimeout = db.LockTimeout
+	}
+
+	return statementTimeout, lockTimeout
+}
+
+// execMigrationBlock runs a migration block inside or outside a transaction
+// according to its options. If any timeouts apply and the driver supports them, the
+// block runs on a dedicated connection which is restored to the server defaults afterwards.
+func (db *DB) execMigrationBlock(ctx context.Context, drv Driver, sqlDB *sql.DB, options ParsedMigrationOptions, txFunc func(dbutil.Transaction) error) error {
+	statementTimeout, lockTimeout := db.migrationTimeouts(options)
+	timeoutDrv, ok := drv.(TimeoutDriver)
+	if !ok && (statementTimeout != 0 || lockTimeout != 0) {
+		db.logger().Debug("Driver does not support timeouts, ignoring them")
+	}
+	if !ok || (statementTimeout == 0 && lockTimeout == 0) {
+		if options.Transaction() {
+			// begin transaction
+			return doTransaction(ctx, sqlDB, txFunc)
+		}
+
+		// run outside of transaction
+		return txFunc(sqlDB)
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer dbutil.MustClose(conn)
+
+	if options.Transaction() {
+		// begin transaction on the dedicated connection
+		err = doTransaction(ctx, conn, func(tx dbutil.Transaction) error {
+			if err := timeoutDrv.SetTimeouts(ctx, tx, statementTimeout, lockTimeout); err != nil {
+				return err
+			}
+
+			return txFunc(tx)
+		})
+	} else {
+		err = timeoutDrv.SetTimeouts(ctx, dbutil.Conn{Conn: conn}, statementTimeout, lockTimeout)
+		if err == nil {
+			err = txFunc(dbutil.Conn{Conn: conn})
+		}
+	}
+
+	// restore server defaults before the connection is returned to the pool,
+	// even if the context has been canceled
+	if resetErr := timeoutDrv.SetTimeouts(context.Background(), dbutil.Conn{Conn: conn}, 0, 0); err == nil {
+		err = resetErr
+	}
+
+	return err
+}
+
+func (db *DB) openDatabaseForMigration(ctx context.Context, drv Driver) (*sql.DB, error) {
 	sqlDB, err := drv.Open()
 	if err != nil {
 		return nil, err
 	}
 
-	if err := drv.CreateMigrationsTable(sqlDB); err != nil {
+	if err := contextDriver(drv).CreateMigrationsTableContext(ctx, sqlDB); err != nil {
 		dbutil.MustClose(sqlDB)
 		return nil, err
 	}
@@ -298,12 +518,27 @@ func (db *DB) openDatabaseForMigration(drv Driver) (*sql.DB, error) {
 
 // Migrate migrates database to the latest version
 func (db *DB) Migrate() error {
-	drv, err := db.Driver()
+	return db.MigrateContext(context.Background())
+}
+
+// MigrateContext migrates database to the latest version. If the context is canceled,
+// the migration in progress is rolled back (where transactions are supported) and
+// no further migrations are applied.
+func (db *DB) MigrateContext(ctx context.Context) error {
+	ctx, span := db.startSpan(ctx, "dbmate.migrate")
+	err := db.migrate(ctx)
+	endSpan(span, err)
+
+	return err
+}
+
+func (db *DB) migrate(ctx context.Context) error {
+	drv, err := db.DriverContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	migrations, err := db.FindMigrations()
+	migrations, _, duplicates, err := db.findMigrations(ctx)
 	if err != nil {
 		return err
 	}
@@ -311,67 +546,150 @@ func (db *DB) Migrate() error {
 	if len(migrations) == 0 {
 		return ErrNoMigrationFiles
 	}
+	db.logDuplicateVersions(ctx, slog.LevelWarn, duplicates)
 
-	highestAppliedMigrationVersion := ""
 	pendingMigrations := []Migration{}
 	for _, migration := range migrations {
 		if migration.Applied {
-			if db.Strict && highestAppliedMigrationVersion <= migration.Version {
-				highestAppliedMigrationVersion = migration.Version
-			}
-		} else {
-			pendingMigrations = append(pendingMigrations, migration)
+			continue
+		}
+		if migration.SkipReason != "" {
+			db.logger().Info(fmt.Sprintf("Skipping: %s (%s)", migration.FileName, migration.SkipReason),
+				EventKey, EventMigrationSkip, "version", migration.Version, "file", migration.FilePath, "reason", migration.SkipReason)
+			continue
 		}
+		pendingMigrations = append(pendingMigrations, migration)
 	}
 
-	if len(pendingMigrations) > 0 && db.Strict && pendingMigrations[0].Version <= highestAppliedMigrationVersion {
-		return fmt.Errorf("migration `%s` is out of order with already applied migrations, the version number has to be higher than the applied migration `%s` in --strict mode", pendingMigrations[0].Version, highestAppliedMigrationVersion)
+	if err := db.checkOutOfOrder(migrations, pendingMigrations); err != nil {
+		return err
 	}
 
-	sqlDB, err := db.openDatabaseForMigration(drv)
+	sqlDB, err := db.openDatabaseForMigration(ctx, drv)
 	if err != nil {
 		return err
 	}
 	defer dbutil.MustClose(sqlDB)
 
-	for _, migration := range pendingMigrations {
-		fmt.Fprintf(db.Log, "Applying: %s\n", migration.FileName)
+	if len(pendingMigrations) > 0 && db.backupEnabled() {
+		if err := db.backup(ctx, sqlDB); err != nil {
+			return err
+		}
+	}
 
-		parsed, err := migration.Parse()
-		if err != nil {
+	if err := db.runHooks(ctx, HookBeforeMigrate, HookEvent{DB: sqlDB}); err != nil {
+		return err
+	}
+
+	for i := range pendingMigrations {
+		migration := &pendingMigrations[i]
+		if err := db.applyMigration(ctx, drv, sqlDB, migration); err != nil {
+			return db.runErrorHooks(ctx, sqlDB, migration, err)
+		}
+
+		if err := db.runHooks(ctx, HookAfterEach, HookEvent{DB: sqlDB, Migration: migration}); err != nil {
 			return err
 		}
+	}
 
-		execMigration := func(tx dbutil.Transaction) error {
-			// run actual migration
-			result, err := tx.Exec(parsed.Up)
-			if err != nil {
-				return drv.QueryError(parsed.Up, err)
-			} else if db.Verbose {
-				db.printVerbose(result)
-			}
+	if err := db.runHooks(ctx, HookAfterMigrate, HookEvent{DB: sqlDB}); err != nil {
+		return err
+	}
+
+	// automatically update schema file, silence errors
+	if db.AutoDumpSchema {
+		_ = db.DumpSchemaContext(ctx)
+	}
+
+	return nil
+}
+
+// applyMigration runs the up block of a migration and records it as applied
+func (db *DB) applyMigration(ctx context.Context, drv Driver, sqlDB *sql.DB, migration *Migration) (err error) {
+	db.logger().Info("Applying: "+migration.FileName, migrationAttrs(EventMigrationStart, migration)...)
+	ctx, span := db.startMigrationSpan(ctx, "dbmate.apply", migration)
+	start := time.Now()
+
+	var result sql.Result
+	defer func() {
+		setResultAttributes(span, result)
+		endSpan(span, err)
+		if err != nil {
+			db.logMigrationError(EventMigrationError, migration, start, err)
+		} else {
+			db.logMigrationFinish(EventMigrationFinish, migration, start, result)
+		}
+	}()
+
+	parsed, err := migration.Parse()
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(AttrMigrationTransaction.Bool(parsed.UpOptions.Transaction()))
 
-			// record migration
-			return drv.InsertMigration(tx, migration.Version)
+	execMigration := func(tx dbutil.Transaction) error {
+		// run actual migration
+		var err error
+		result, err = dbutil.ExecContext(ctx, tx, parsed.Up)
+		if err != nil {
+			return drv.QueryError(parsed.Up, err)
+		} else if db.Verbose {
+			db.printVerbose(result)
 		}
 
-		if parsed.UpOptions.Transaction() {
-			// begin transaction
-			err = doTransaction(sqlDB, execMigration)
+		// record migration
+		return contextDriver(drv).InsertMigrationContext(ctx, tx, migration.Version)
+	}
+
+	if err := db.execMigrationBlock(ctx, drv, sqlDB, parsed.UpOptions, execMigration); err != nil {
+		return err
+	}
+	migration.Applied = true
+
+	return nil
+}
+
+// rollbackMigration runs the down block of a migration and removes its record
+func (db *DB) rollbackMigration(ctx context.Context, drv Driver, sqlDB *sql.DB, migration *Migration) (err error) {
+	db.logger().Info("Rolling back: "+migration.FileName, migrationAttrs(EventRollbackStart, migration)...)
+	ctx, span := db.startMigrationSpan(ctx, "dbmate.rollback_migration", migration)
+	start := time.Now()
+
+	var result sql.Result
+	defer func() {
+		setResultAttributes(span, result)
+		endSpan(span, err)
+		if err != nil {
+			db.logMigrationError(EventRollbackError, migration, start, err)
 		} else {
-			// run outside of transaction
-			err = execMigration(sqlDB)
+			db.logMigrationFinish(EventRollbackFinish, migration, start, result)
 		}
+	}()
+
+	parsed, err := migration.Parse()
+	if err != nil {
+		return err
+	}
+	span.SetAttributes(AttrMigrationTransaction.Bool(parsed.DownOptions.Transaction()))
 
+	execMigration := func(tx dbutil.Transaction) error {
+		// rollback migration
+		var err error
+		result, err = dbutil.ExecContext(ctx, tx, parsed.Down)
 		if err != nil {
-			return err
+			return drv.QueryError(parsed.Down, err)
+		} else if db.Verbose {
+			db.printVerbose(result)
 		}
+
+		// remove migration record
+		return contextDriver(drv).DeleteMigrationContext(ctx, tx, migration.Version)
 	}
 
-	// automatically update schema file, silence errors
-	if db.AutoDumpSchema {
-		_ = db.DumpSchema()
+	if err := db.execMigrationBlock(ctx, drv, sqlDB, parsed.DownOptions, execMigration); err != nil {
+		return err
 	}
+	migration.Applied = false
 
 	return nil
 }
@@ -379,102 +697,286 @@ func (db *DB) Migrate() error {
 func (db *DB) printVerbose(result sql.Result) {
 	lastInsertID, err := result.LastInsertId()
 	if err == nil {
-		fmt.Fprintf(db.Log, "Last insert ID: %d\n", lastInsertID)
+		db.logger().Info(fmt.Sprintf("Last insert ID: %d", lastInsertID), EventKey, EventMigrationResult, "last_insert_id", lastInsertID)
 	}
 	rowsAffected, err := result.RowsAffected()
 	if err == nil {
-		fmt.Fprintf(db.Log, "Rows affected: %d\n", rowsAffected)
+		db.logger().Info(fmt.Sprintf("Rows affected: %d", rowsAffected), EventKey, EventMigrationResult, "rows_affected", rowsAffected)
+	}
+}
+
+// migrationDirFile is a file found in a migrations directory
+type migrationDirFile struct {
+	// Name is the base name of the file
+	Name string
+	// Path is the path of the file, including the migrations directory
+	Path string
+}
+
+// migrationsFromFiles returns the migrations for the files in a migrations directory,
+// and any files whose names are not valid migrations. The .up.sql and .down.sql files
+// of a split migration are combined into a single migration.
+func (db *DB) migrationsFromFiles(files []migrationDirFile) ([]Migration, []migrationDirFile) {
+	migrations := []Migration{}
+	invalid := []migrationDirFile{}
+	splitIndexes := map[string]int{}
+
+	for _, file := range files {
+		matches := migrationFileRegexp.FindStringSubmatch(file.Name)
+		if len(matches) < 2 {
+			invalid = append(invalid, file)
+			continue
+		}
+
+		migration := Migration{
+			Applied:  false,
+			FileName: matches[0],
+			FilePath: file.Path,
+			FS:       db.FS,
+			Version:  matches[1],
+		}
+
+		split := splitMigrationRegExp.FindStringSubmatch(file.Path)
+		if split == nil {
+			migrations = append(migrations, migration)
+			continue
+		}
+
+		// pair the up and down files, which share a path apart from the suffix
+		if split[2] == "down" {
+			migration.DownFilePath = file.Path
+		}
+		i, ok := splitIndexes[split[1]]
+		if !ok {
+			splitIndexes[split[1]] = len(migrations)
+			migrations = append(migrations, migration)
+		} else if split[2] == "down" {
+			migrations[i].DownFilePath = file.Path
+		} else {
+			migration.DownFilePath = migrations[i].DownFilePath
+			migrations[i] = migration
+		}
 	}
+
+	return migrations, invalid
 }
 
-func (db *DB) readMigrationsDir(dir string) ([]fs.DirEntry, error) {
-	path := filepath.Clean(dir)
+// readMigrationsDir lists the files in a migrations directory, including files in
+// subdirectories if db.Recursive is set. Hidden directories, and any paths matching
+// db.IgnorePatterns, are skipped.
+func (db *DB) readMigrationsDir(dir string) ([]migrationDirFile, error) {
+	root := filepath.Clean(dir)
 
-	// We use nil instead of os.DirFS() because DirFS cannot support both relative and absolute
+	// We use nil instead of os.DirFS(".") because DirFS cannot support both relative and absolute
 	// directory paths - it must be anchored at either "." or "/", which we do not know in advance.
+	// Instead, we anchor DirFS at the migrations directory itself.
 	// See: https://github.com/amacneil/dbmate/issues/403
-	if db.FS == nil {
-		return os.ReadDir(path)
+	fsys, walkRoot := db.FS, db.fsPath(dir)
+	if fsys == nil {
+		fsys, walkRoot = os.DirFS(root), "."
+	}
+
+	files := []migrationDirFile{}
+	err := fs.WalkDir(fsys, walkRoot, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == walkRoot {
+			return nil
+		}
+
+		rel := p
+		if walkRoot != "." {
+			rel = strings.TrimPrefix(p, walkRoot+"/")
+		}
+
+		ignored, err := db.ignoreMigrationPath(rel, d.Name())
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if !db.Recursive || ignored || strings.HasPrefix(d.Name(), ".") {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if ignored {
+			return nil
+		}
+
+		files = append(files, migrationDirFile{Name: d.Name(), Path: db.joinPath(dir, db.fromSlash(rel))})
+		return nil
+	})
+
+	return files, err
+}
+
+// ignoreMigrationPath returns true if a path (relative to the migrations directory)
+// or its base name matches any of db.IgnorePatterns
+func (db *DB) ignoreMigrationPath(rel, name string) (bool, error) {
+	for _, pattern := range db.IgnorePatterns {
+		for _, target := range []string{rel, name} {
+			matched, err := path.Match(pattern, target)
+			if err != nil {
+				return false, fmt.Errorf("invalid ignore pattern `%s`: %w", pattern, err)
+			}
+			if matched {
+				return true, nil
+			}
+		}
 	}
 
-	return fs.ReadDir(db.FS, path)
+	return false, nil
 }
 
 // FindMigrations lists all available migrations
 func (db *DB) FindMigrations() ([]Migration, error) {
-	drv, err := db.Driver()
+	return db.FindMigrationsContext(context.Background())
+}
+
+// FindMigrationsContext lists all available migrations
+func (db *DB) FindMigrationsContext(ctx context.Context) ([]Migration, error) {
+	migrations, _, duplicates, err := db.findMigrations(ctx)
+	db.logDuplicateVersions(ctx, slog.LevelDebug, duplicates)
+
+	return migrations, err
+}
+
+// migrationFiles lists all migration files in MigrationsDir, sorted by version,
+// without connecting to the database
+func (db *DB) migrationFiles() ([]Migration, error) {
+	migrations, duplicates, err := db.readMigrationFiles()
+	db.logDuplicateVersions(context.Background(), slog.LevelDebug, duplicates)
+
+	return migrations, err
+}
+
+// readMigrationFiles lists all migration files in MigrationsDir, sorted by version, and
+// the migrations which are not used because of a version collision with another directory
+func (db *DB) readMigrationFiles() ([]Migration, []Migration, error) {
+	migrations, otherDrivers := []Migration{}, []Migration{}
+	dirIndexes := []int{}
+	for dirIndex, dir := range db.MigrationsDir {
+		// find filesystem migrations
+		files, err := db.readMigrationsDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("%w `%s`", ErrMigrationDirNotFound, dir)
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		dirMigrations, _ := db.migrationsFromFiles(files)
+		for _, migration := range dirMigrations {
+			// migrations for other drivers are ignored, and may share versions
+			if !db.targetsDriver(migration) {
+				db.logger().Debug("Ignoring migration for another driver: "+migration.FilePath, EventKey, EventMigrationSkip, "file", migration.FilePath)
+				otherDrivers = append(otherDrivers, migration)
+				continue
+			}
+			migrations = append(migrations, migration)
+			dirIndexes = append(dirIndexes, dirIndex)
+		}
+	}
+
+	conflicts, skip, err := db.resolveCollisions(migrations, dirIndexes)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	if len(conflicts) > 0 {
+		errs := []error{}
+		for _, version := range sortedKeys(conflicts) {
+			errs = append(errs, fmt.Errorf("%w `%s`: %s", ErrDuplicateVersion, version, strings.Join(conflicts[version], ", ")))
+		}
+		return nil, nil, errors.Join(errs...)
+	}
+
+	resolved, duplicates := []Migration{}, []Migration{}
+	for i, migration := range migrations {
+		if skip[i] {
+			duplicates = append(duplicates, migration)
+			continue
+		}
+		resolved = append(resolved, migration)
+	}
+	migrations = resolved
+
+	sortMigrations(migrations)
+
+	migrations, err = orderMigrations(migrations, otherDrivers)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return migrations, duplicates, nil
+}
+
+// findMigrations lists all available migrations, all versions recorded as applied in
+// the database (including any without a migration file), and the migrations which are
+// not used because of a version collision with another directory
+func (db *DB) findMigrations(ctx context.Context) ([]Migration, map[string]bool, []Migration, error) {
+	// read migration files before connecting, so that missing directories are reported quickly
+	migrations, duplicates, err := db.readMigrationFiles()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	drv, err := db.DriverContext(ctx)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
 	sqlDB, err := drv.Open()
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 	defer dbutil.MustClose(sqlDB)
 
 	// find applied migrations
 	appliedMigrations := map[string]bool{}
-	migrationsTableExists, err := drv.MigrationsTableExists(sqlDB)
+	migrationsTableExists, err := contextDriver(drv).MigrationsTableExistsContext(ctx, sqlDB)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	if migrationsTableExists {
-		appliedMigrations, err = drv.SelectMigrations(sqlDB, -1)
+		appliedMigrations, err = contextDriver(drv).SelectMigrationsContext(ctx, sqlDB, -1)
 		if err != nil {
-			return nil, err
+			return nil, nil, nil, err
 		}
 	}
 
-	migrations := []Migration{}
-	for _, dir := range db.MigrationsDir {
-		// find filesystem migrations
-		files, err := db.readMigrationsDir(dir)
-		if err != nil {
-			return nil, fmt.Errorf("%w `%s`", ErrMigrationDirNotFound, dir)
-		}
-
-		for _, file := range files {
-			if file.IsDir() {
-				continue
-			}
-
-			matches := migrationFileRegexp.FindStringSubmatch(file.Name())
-			if len(matches) < 2 {
-				continue
-			}
-
-			migration := Migration{
-				Applied:  false,
-				FileName: matches[0],
-				FilePath: filepath.Join(dir, matches[0]),
-				FS:       db.FS,
-				Version:  matches[1],
-			}
-			if ok := appliedMigrations[migration.Version]; ok {
-				migration.Applied = true
-			}
-
-			migrations = append(migrations, migration)
+	for i := range migrations {
+		if ok := appliedMigrations[migrations[i].Version]; ok {
+			migrations[i].Applied = true
 		}
 	}
+	db.markSkipped(migrations)
 
-	sort.Slice(migrations, func(i, j int) bool {
-		return migrations[i].FileName < migrations[j].FileName
-	})
-
-	return migrations, nil
+	return migrations, appliedMigrations, duplicates, nil
 }
 
 // Rollback rolls back the most recent migration
 func (db *DB) Rollback() error {
-	drv, err := db.Driver()
+	return db.RollbackContext(context.Background())
+}
+
+// RollbackContext rolls back the most recent migration
+func (db *DB) RollbackContext(ctx context.Context) error {
+	ctx, span := db.startSpan(ctx, "dbmate.rollback")
+	err := db.rollback(ctx)
+	endSpan(span, err)
+
+	return err
+}
+
+func (db *DB) rollback(ctx context.Context) error {
+	drv, err := db.DriverContext(ctx)
 	if err != nil {
 		return err
 	}
 
-	sqlDB, err := db.openDatabaseForMigration(drv)
+	sqlDB, err := db.openDatabaseForMigration(ctx, drv)
 	if err != nil {
 		return err
 	}
@@ -482,7 +984,7 @@ func (db *DB) Rollback() error {
 
 	// find last applied migration
 	var latest *Migration
-	migrations, err := db.FindMigrations()
+	migrations, err := db.FindMigrationsContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -497,41 +999,21 @@ func (db *DB) Rollback() error {
 		return ErrNoRollback
 	}
 
-	fmt.Fprintf(db.Log, "Rolling back: %s\n", latest.FileName)
-
-	parsed, err := latest.Parse()
-	if err != nil {
+	if err := db.runHooks(ctx, HookBeforeRollback, HookEvent{DB: sqlDB, Migration: latest}); err != nil {
 		return err
 	}
 
-	execMigration := func(tx dbutil.Transaction) error {
-		// rollback migration
-		result, err := tx.Exec(parsed.Down)
-		if err != nil {
-			return drv.QueryError(parsed.Down, err)
-		} else if db.Verbose {
-			db.printVerbose(result)
-		}
-
-		// remove migration record
-		return drv.DeleteMigration(tx, latest.Version)
-	}
-
-	if parsed.DownOptions.Transaction() {
-		// begin transaction
-		err = doTransaction(sqlDB, execMigration)
-	} else {
-		// run outside of transaction
-		err = execMigration(sqlDB)
+	if err := db.rollbackMigration(ctx, drv, sqlDB, latest); err != nil {
+		return db.runErrorHooks(ctx, sqlDB, latest, err)
 	}
 
-	if err != nil {
+	if err := db.runHooks(ctx, HookAfterRollback, HookEvent{DB: sqlDB, Migration: latest}); err != nil {
 		return err
 	}
 
 	// automatically update schema file, silence errors
 	if db.AutoDumpSchema {
-		_ = db.DumpSchema()
+		_ = db.DumpSchemaContext(ctx)
 	}
 
 	return nil
@@ -539,32 +1021,99 @@ func (db *DB) Rollback() error {
 
 // Status shows the status of all migrations
 func (db *DB) Status(quiet bool) (int, error) {
-	results, err := db.FindMigrations()
+	return db.StatusContext(context.Background(), quiet)
+}
+
+// StatusContext shows the status of all migrations
+func (db *DB) StatusContext(ctx context.Context, quiet bool) (int, error) {
+	results, err := db.FindMigrationsContext(ctx)
 	if err != nil {
 		return -1, err
 	}
 
-	var totalApplied int
+	var totalApplied, totalSkipped int
 	var line string
 
 	for _, res := range results {
 		if res.Applied {
 			line = fmt.Sprintf("[X] %s", res.FileName)
 			totalApplied++
+		} else if res.SkipReason != "" {
+			line = fmt.Sprintf("[-] %s (skipped: %s)", res.FileName, res.SkipReason)
+			totalSkipped++
 		} else {
 			line = fmt.Sprintf("[ ] %s", res.FileName)
 		}
+		if len(res.Depends) > 0 {
+			line += " <- " + strings.Join(res.Depends, ", ")
+		}
 		if !quiet {
 			fmt.Fprintln(db.Log, line)
 		}
 	}
 
-	totalPending := len(results) - totalApplied
+	totalPending := len(results) - totalApplied - totalSkipped
 	if !quiet {
 		fmt.Fprintln(db.Log)
 		fmt.Fprintf(db.Log, "Applied: %d\n", totalApplied)
 		fmt.Fprintf(db.Log, "Pending: %d\n", totalPending)
+		if totalSkipped > 0 {
+			fmt.Fprintf(db.Log, "Skipped: %d\n", totalSkipped)
+		}
 	}
 
 	return totalPending, nil
 }
+
+// Summary returns an overview of the migration status
+func (db *DB) Summary() (*Summary, error) {
+	return db.SummaryContext(context.Background())
+}
+
+// SummaryContext returns an overview of the migration status
+func (db *DB) SummaryContext(ctx context.Context) (*Summary, error) {
+	migrations, appliedMigrations, duplicates, err := db.findMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	db.logDuplicateVersions(ctx, slog.LevelDebug, duplicates)
+
+	summary := &Summary{}
+	for version := range appliedMigrations {
+		if compareVersions(version, summary.LastApplied) > 0 {
+			summary.LastApplied = version
+		}
+	}
+
+	graph := hasDependencies(migrations)
+	dependents := appliedDependents(migrations)
+	files := map[string]bool{}
+	for _, migration := range migrations {
+		files[migration.Version] = true
+		if migration.Applied {
+			summary.Applied++
+			continue
+		}
+		if migration.SkipReason != "" {
+			summary.Skipped++
+			continue
+		}
+
+		summary.Pending++
+		if allowsOutOfOrder(&migration) {
+			continue
+		}
+		if _, ok := dependents[migration.Version]; ok || (!graph && compareVersions(migration.Version, summary.LastApplied) < 0) {
+			summary.OutOfOrder = append(summary.OutOfOrder, migration.Version)
+		}
+	}
+
+	for version := range appliedMigrations {
+		if !files[version] {
+			summary.Missing = append(summary.Missing, version)
+		}
+	}
+	sort.Strings(summary.Missing)
+
+	return summary, nil
+}
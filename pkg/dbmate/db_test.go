@@ -1,9 +1,19 @@
 package dbmate_test
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"testing"
 	"testing/fstest"
 	"time"
@@ -12,10 +22,13 @@ import (
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
 	_ "github.com/amacneil/dbmate/v2/pkg/driver/mysql"
 	_ "github.com/amacneil/dbmate/v2/pkg/driver/postgres"
-	_ "github.com/amacneil/dbmate/v2/pkg/driver/sqlite"
+	"github.com/amacneil/dbmate/v2/pkg/driver/sqlite"
 
 	"github.com/stretchr/testify/require"
 	"github.com/zenizh/go-capturer"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 var rootDir string
@@ -45,9 +58,12 @@ func TestNew(t *testing.T) {
 	require.Equal(t, []string{"./db/migrations"}, db.MigrationsDir)
 	require.Equal(t, "schema_migrations", db.MigrationsTableName)
 	require.Equal(t, "./db/schema.sql", db.SchemaFile)
+	require.Equal(t, time.Duration(0), db.StatementTimeout)
+	require.Equal(t, time.Duration(0), db.LockTimeout)
 	require.False(t, db.WaitBefore)
 	require.Equal(t, time.Second, db.WaitInterval)
 	require.Equal(t, 60*time.Second, db.WaitTimeout)
+	require.Equal(t, dbmate.OSWriter{}, db.Writer)
 }
 
 func TestGetDriver(t *testing.T) {
@@ -97,6 +113,20 @@ func TestWait(t *testing.T) {
 	require.Contains(t, err.Error(), "connect: connection refused")
 }
 
+func TestWaitContextCanceled(t *testing.T) {
+	u := dbutil.MustParseURL(os.Getenv("POSTGRES_TEST_URL"))
+	u.Host = "postgres:404"
+	db := newTestDB(t, u)
+	db.WaitInterval = time.Hour
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	// wait returns as soon as the context is done, rather than after the interval
+	err := db.WaitContext(ctx)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
 func TestDumpSchema(t *testing.T) {
 	u := dbutil.MustParseURL(os.Getenv("POSTGRES_TEST_URL"))
 	db := newTestDB(t, u)
@@ -286,6 +316,304 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
+func TestMigrateContextCanceled(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			// no migrations are applied once the context is canceled
+			err = db.MigrateContext(ctx)
+			require.True(t, errors.Is(err, context.Canceled))
+
+			results, err := db.FindMigrations()
+			require.NoError(t, err)
+			require.Len(t, results, 2)
+			require.False(t, results[0].Applied)
+			require.False(t, results[1].Applied)
+		})
+	}
+}
+
+func TestMigrateHooks(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.FS = fstest.MapFS{
+				"db/migrations/001_test_migration_a.sql": {
+					Data: []byte("-- migrate:up\ncreate table hooks_a (id int);\n-- migrate:down\ndrop table hooks_a;\n"),
+				},
+				"db/migrations/002_test_migration_b.sql": {
+					Data: []byte("-- migrate:up\ncreate table hooks_b (id int);\n-- migrate:down\ndrop table hooks_b;\n"),
+				},
+				"db/hooks/after_migrate.sql": {
+					Data: []byte("create table hooks_after (id int);\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			var events []string
+			record := func(ctx context.Context, event dbmate.HookEvent) error {
+				name := string(event.Hook)
+				if event.Migration != nil {
+					name += " " + event.Migration.Version
+				}
+				events = append(events, name)
+				return nil
+			}
+			for _, hook := range dbmate.HookPoints {
+				db.AddHook(hook, record)
+			}
+			db.AddSQLHook(dbmate.HookAfterMigrate, "db/hooks/after_migrate.sql")
+
+			err = db.Migrate()
+			require.NoError(t, err)
+			err = db.Rollback()
+			require.NoError(t, err)
+
+			require.Equal(t, []string{
+				"before-migrate",
+				"after-each 001",
+				"after-each 002",
+				"after-migrate",
+				"before-rollback 002",
+				"after-rollback 002",
+			}, events)
+
+			// sql hook was executed
+			drv, err := db.Driver()
+			require.NoError(t, err)
+			sqlDB, err := drv.Open()
+			require.NoError(t, err)
+			defer dbutil.MustClose(sqlDB)
+
+			count := 0
+			err = sqlDB.QueryRow("select count(*) from hooks_after").Scan(&count)
+			require.NoError(t, err)
+			require.Equal(t, 0, count)
+		})
+	}
+}
+
+func TestMigrateHooksOnError(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.FS = fstest.MapFS{
+				"db/migrations/001_test_migration_a.sql": {
+					Data: []byte("-- migrate:up\nnot_valid_sql;\n-- migrate:down\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			var hookErr error
+			var hookMigration *dbmate.Migration
+			db.AddHook(dbmate.HookOnError, func(ctx context.Context, event dbmate.HookEvent) error {
+				hookErr = event.Err
+				hookMigration = event.Migration
+				return errors.New("notification failed")
+			})
+			db.AddHook(dbmate.HookAfterMigrate, func(ctx context.Context, event dbmate.HookEvent) error {
+				t.Fatal("after-migrate hook should not run")
+				return nil
+			})
+
+			err = db.Migrate()
+			require.Error(t, err)
+			require.ErrorContains(t, err, "not_valid_sql")
+			require.ErrorContains(t, err, "on-error hook failed: notification failed")
+
+			require.Error(t, hookErr)
+			require.True(t, errors.Is(err, hookErr))
+			require.Equal(t, "001", hookMigration.Version)
+		})
+	}
+}
+
+func TestMigrateLogger(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.FS = fstest.MapFS{
+				"db/migrations/001_test_migration_a.sql": {
+					Data: []byte("-- migrate:up\ncreate table logger_a (id int);\n-- migrate:down\ndrop table logger_a;\n"),
+				},
+				"db/migrations/002_test_migration_b.sql": {
+					Data: []byte("-- migrate:up\nnot_valid_sql;\n-- migrate:down\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			db.Logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+			err = db.Migrate()
+			require.ErrorContains(t, err, "not_valid_sql")
+
+			var records []map[string]any
+			decoder := json.NewDecoder(&buf)
+			for decoder.More() {
+				record := map[string]any{}
+				require.NoError(t, decoder.Decode(&record))
+				records = append(records, record)
+			}
+
+			var events []string
+			for _, record := range records {
+				events = append(events, fmt.Sprintf("%s %s", record[dbmate.EventKey], record["version"]))
+			}
+			require.Equal(t, []string{
+				"migration_start 001",
+				"migration_finish 001",
+				"migration_start 002",
+				"migration_error 002",
+			}, events)
+
+			require.Equal(t, "Applying: 001_test_migration_a.sql", records[0]["msg"])
+			require.Equal(t, "db/migrations/001_test_migration_a.sql", records[0]["file"])
+			require.Contains(t, records[1], "duration")
+			require.Equal(t, "ERROR", records[3]["level"])
+			require.Contains(t, records[3]["error"], "not_valid_sql")
+		})
+	}
+}
+
+func TestMigrateTracing(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.AutoDumpSchema = false
+			db.FS = fstest.MapFS{
+				"db/migrations/001_test_migration_a.sql": {
+					Data: []byte("-- migrate:up\ncreate table tracing_a (id int);\n-- migrate:down\ndrop table tracing_a;\n"),
+				},
+				"db/migrations/002_test_migration_b.sql": {
+					Data: []byte("-- migrate:up transaction:false\nnot_valid_sql;\n-- migrate:down\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			recorder := tracetest.NewSpanRecorder()
+			db.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+			err = db.Migrate()
+			require.ErrorContains(t, err, "not_valid_sql")
+
+			spans := recorder.Ended()
+			require.Len(t, spans, 3)
+			migrate := spans[2]
+			require.Equal(t, "dbmate.migrate", migrate.Name())
+			require.Equal(t, codes.Error, migrate.Status().Code)
+
+			// first migration succeeded in a transaction
+			require.Equal(t, "dbmate.apply", spans[0].Name())
+			require.Equal(t, migrate.SpanContext().SpanID(), spans[0].Parent().SpanID())
+			require.Equal(t, codes.Unset, spans[0].Status().Code)
+			require.Contains(t, spans[0].Attributes(), dbmate.AttrDBSystem.String(u.Scheme))
+			require.Contains(t, spans[0].Attributes(), dbmate.AttrMigrationVersion.String("001"))
+			require.Contains(t, spans[0].Attributes(), dbmate.AttrMigrationFile.String("db/migrations/001_test_migration_a.sql"))
+			require.Contains(t, spans[0].Attributes(), dbmate.AttrMigrationTransaction.Bool(true))
+
+			// second migration failed outside a transaction
+			require.Equal(t, "dbmate.apply", spans[1].Name())
+			require.Equal(t, codes.Error, spans[1].Status().Code)
+			require.Contains(t, spans[1].Attributes(), dbmate.AttrMigrationVersion.String("002"))
+			require.Contains(t, spans[1].Attributes(), dbmate.AttrMigrationTransaction.Bool(false))
+			require.Len(t, spans[1].Events(), 1)
+			require.Equal(t, "exception", spans[1].Events()[0].Name)
+		})
+	}
+}
+
+func TestSummary(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.AutoDumpSchema = false
+			db.FS = fstest.MapFS{
+				"db/migrations/001_test_migration_a.sql": {
+					Data: []byte("-- migrate:up\ncreate table summary_a (id int);\n-- migrate:down\ndrop table summary_a;\n"),
+				},
+				"db/migrations/003_test_migration_c.sql": {
+					Data: []byte("-- migrate:up\ncreate table summary_c (id int);\n-- migrate:down\ndrop table summary_c;\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			summary, err := db.Summary()
+			require.NoError(t, err)
+			require.Equal(t, &dbmate.Summary{Pending: 2}, summary)
+			require.False(t, summary.Drift())
+
+			err = db.Migrate()
+			require.NoError(t, err)
+
+			// add an out of order migration, and remove an applied migration file
+			db.FS = fstest.MapFS{
+				"db/migrations/002_test_migration_b.sql": {
+					Data: []byte("-- migrate:up\ncreate table summary_b (id int);\n-- migrate:down\ndrop table summary_b;\n"),
+				},
+				"db/migrations/003_test_migration_c.sql": {
+					Data: []byte("-- migrate:up\ncreate table summary_c (id int);\n-- migrate:down\ndrop table summary_c;\n"),
+				},
+			}
+
+			summary, err = db.Summary()
+			require.NoError(t, err)
+			require.Equal(t, &dbmate.Summary{
+				Applied:     1,
+				Pending:     1,
+				LastApplied: "003",
+				Missing:     []string{"001"},
+				OutOfOrder:  []string{"002"},
+			}, summary)
+			require.True(t, summary.Drift())
+		})
+	}
+}
+
+func TestParseHook(t *testing.T) {
+	hook, err := dbmate.ParseHook("after-each")
+	require.NoError(t, err)
+	require.Equal(t, dbmate.HookAfterEach, hook)
+
+	_, err = dbmate.ParseHook("afterEach")
+	require.EqualError(t, err, "unsupported hook: afterEach")
+}
+
 func TestUp(t *testing.T) {
 	for _, u := range testURLs() {
 		t.Run(u.Scheme, func(t *testing.T) {
@@ -584,6 +912,130 @@ func TestFindMigrationsFSMultipleDirs(t *testing.T) {
 	require.Equal(t, "db/migrations_c/006_test_migration_c.sql", actual[5].FilePath)
 }
 
+func TestFindMigrationsRecursive(t *testing.T) {
+	migration := []byte("-- migrate:up\n-- migrate:down\n")
+	files := map[string][]byte{
+		"db/migrations/003_comments.sql":            migration,
+		"db/migrations/2023/001_users.sql":          migration,
+		"db/migrations/2024/002_posts.sql":          migration,
+		"db/migrations/2024/drafts/004_likes.sql":   migration,
+		"db/migrations/2024/005_tags.sql.bak":       migration,
+		"db/migrations/.archive/000_old.sql":        migration,
+		"db/migrations/2024/006_ignored_seed.sql":   migration,
+		"db/migrations/2024/feature/007_search.sql": migration,
+	}
+
+	// test both the OS filesystem and db.FS
+	dir := t.TempDir()
+	mapFS := fstest.MapFS{}
+	for name, data := range files {
+		mapFS[name] = &fstest.MapFile{Data: data}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, data, 0o644))
+	}
+
+	for _, tc := range []struct {
+		name string
+		fs   fs.FS
+		root string
+	}{
+		{"os", nil, filepath.Join(dir, "db/migrations")},
+		{"fs", mapFS, "db/migrations"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			db := dbmate.New(dbutil.MustParseURL("sqlite:" + filepath.Join(t.TempDir(), "app.sqlite3")))
+			db.Log = io.Discard
+			db.FS = tc.fs
+			db.MigrationsDir = []string{tc.root}
+
+			versions := func() []string {
+				migrations, err := db.FindMigrations()
+				require.NoError(t, err)
+				result := []string{}
+				for _, migration := range migrations {
+					result = append(result, migration.Version)
+				}
+				return result
+			}
+
+			// only direct children by default
+			require.Equal(t, []string{"003"}, versions())
+
+			// recursive mode keeps global ordering by version
+			db.Recursive = true
+			require.Equal(t, []string{"001", "002", "003", "004", "006", "007"}, versions())
+
+			// ignore patterns match base names and relative paths
+			db.IgnorePatterns = []string{"*_seed.sql", "2024/drafts", "2024/feature/*"}
+			require.Equal(t, []string{"001", "002", "003"}, versions())
+
+			migrations, err := db.FindMigrations()
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(tc.root, "2023", "001_users.sql"), migrations[0].FilePath)
+			require.Equal(t, "001_users.sql", migrations[0].FileName)
+
+			// parse from the nested path
+			_, err = migrations[0].Parse()
+			require.NoError(t, err)
+
+			db.IgnorePatterns = []string{"["}
+			_, err = db.FindMigrations()
+			require.EqualError(t, err, "invalid ignore pattern `[`: syntax error in pattern")
+		})
+	}
+}
+
+func TestFindMigrationsDriver(t *testing.T) {
+	expected := map[string][]string{
+		"postgres": {
+			"db/migrations/001_users.sql",
+			"db/migrations/002_events_postgres.sql",
+			"db/migrations/003_cache.sql",
+		},
+		"mysql": {
+			"db/migrations/001_users.sql",
+			"db/migrations/002_events_mysql.sql",
+		},
+		// sqlite3 is an alias, which matches the canonical driver name
+		"sqlite3": {
+			"db/migrations/001_users.sql",
+			"db/migrations/003_cache.sql",
+		},
+	}
+
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.FS = fstest.MapFS{
+				"db/migrations/001_users.sql":           {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+				"db/migrations/002_events_postgres.sql": {Data: []byte("-- migrate:up driver:postgres\n-- migrate:down\n")},
+				"db/migrations/002_events_mysql.sql":    {Data: []byte("-- migrate:up driver:mysql\n-- migrate:down\n")},
+				"db/migrations/003_cache.sql":           {Data: []byte("-- migrate:up driver:sqlite,postgres\n-- migrate:down\n")},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			// migrations for other drivers are ignored, and may share versions
+			migrations, err := db.FindMigrations()
+			require.NoError(t, err)
+			paths := []string{}
+			for _, migration := range migrations {
+				paths = append(paths, migration.FilePath)
+			}
+			require.Equal(t, expected[u.Scheme], paths)
+
+			problems, err := db.Validate()
+			require.NoError(t, err)
+			require.Empty(t, problems)
+		})
+	}
+}
+
 func TestMigrateUnrestrictedOrder(t *testing.T) {
 	emptyMigration := []byte("-- migrate:up\n-- migrate:down")
 
@@ -776,3 +1228,811 @@ func TestMigrationContents(t *testing.T) {
 		})
 	}
 }
+
+func TestMigrateSplitFiles(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.AutoDumpSchema = false
+			db.FS = fstest.MapFS{
+				"db/migrations/001_create_split.up.sql":   {Data: []byte("create table split_a (id int);\n")},
+				"db/migrations/001_create_split.down.sql": {Data: []byte("drop table split_a;\n")},
+				"db/migrations/002_test_migration.sql": {
+					Data: []byte("-- migrate:up\ncreate table split_b (id int);\n-- migrate:down\ndrop table split_b;\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			migrations, err := db.FindMigrations()
+			require.NoError(t, err)
+			require.Len(t, migrations, 2)
+			require.Equal(t, "001_create_split.up.sql", migrations[0].FileName)
+			require.Equal(t, "db/migrations/001_create_split.up.sql", migrations[0].FilePath)
+			require.Equal(t, "db/migrations/001_create_split.down.sql", migrations[0].DownFilePath)
+			require.True(t, migrations[0].IsSplit())
+
+			err = db.Migrate()
+			require.NoError(t, err)
+
+			drv, err := db.Driver()
+			require.NoError(t, err)
+			sqlDB, err := drv.Open()
+			require.NoError(t, err)
+			defer dbutil.MustClose(sqlDB)
+
+			count := 0
+			err = sqlDB.QueryRow("select count(*) from split_a").Scan(&count)
+			require.NoError(t, err)
+
+			// roll back both migrations, using the down file of the split migration
+			err = db.Rollback()
+			require.NoError(t, err)
+			err = db.Rollback()
+			require.NoError(t, err)
+
+			err = sqlDB.QueryRow("select count(*) from split_a").Scan(&count)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestImportHistory(t *testing.T) {
+	writeFiles := func(t *testing.T, files map[string]string) string {
+		dir := t.TempDir()
+		for name, contents := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+		}
+		return dir
+	}
+
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.Log = io.Discard
+			drv, err := db.Driver()
+			require.NoError(t, err)
+
+			// drop and recreate database
+			err = db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			sqlDB, err := drv.Open()
+			require.NoError(t, err)
+			defer dbutil.MustClose(sqlDB)
+
+			applied := func() []string {
+				versions, err := drv.SelectMigrations(sqlDB, -1)
+				require.NoError(t, err)
+				result := []string{}
+				for version := range versions {
+					result = append(result, version)
+				}
+				sort.Strings(result)
+				return result
+			}
+
+			t.Run("goose", func(t *testing.T) {
+				dir := writeFiles(t, map[string]string{
+					"00001_a.sql": "-- +goose Up\n-- +goose Down\n",
+					"00002_b.sql": "-- +goose Up\n-- +goose Down\n",
+					"00003_c.sql": "-- +goose Up\n-- +goose Down\n",
+				})
+				_, err := sqlDB.Exec("create table goose_db_version (id int, version_id bigint, is_applied boolean)")
+				require.NoError(t, err)
+				_, err = sqlDB.Exec(`insert into goose_db_version (id, version_id, is_applied)
+					values (1, 0, true), (2, 1, true), (3, 2, true), (4, 3, true), (5, 3, false)`)
+				require.NoError(t, err)
+
+				err = db.Import(dbmate.ImportOptions{From: dbmate.ImportGoose, Dir: dir, SkipFiles: true})
+				require.NoError(t, err)
+				require.Equal(t, []string{"00001", "00002"}, applied())
+			})
+
+			t.Run("flyway", func(t *testing.T) {
+				dir := writeFiles(t, map[string]string{
+					"V1__a.sql":   "",
+					"V1.1__b.sql": "",
+					"V2__c.sql":   "",
+					"U2__c.sql":   "",
+					"V3__d.sql":   "",
+				})
+				_, err := sqlDB.Exec(`create table flyway_schema_history (installed_rank int,
+					version varchar(50), type varchar(20), success boolean)`)
+				require.NoError(t, err)
+				_, err = sqlDB.Exec(`insert into flyway_schema_history (installed_rank, version, type, success)
+					values (1, '1', 'BASELINE', true), (2, '1.1', 'SQL', true), (3, '2', 'SQL', true),
+					(4, '2', 'UNDO_SQL', true), (5, '3', 'SQL', false), (6, null, 'SQL', true)`)
+				require.NoError(t, err)
+
+				err = db.Import(dbmate.ImportOptions{From: dbmate.ImportFlyway, Dir: dir, SkipFiles: true})
+				require.NoError(t, err)
+				require.Equal(t, []string{"00001", "00002", "10", "11"}, applied())
+			})
+
+			t.Run("golang-migrate", func(t *testing.T) {
+				dir := writeFiles(t, map[string]string{
+					"1_a.up.sql":   "",
+					"1_a.down.sql": "",
+					"2_b.up.sql":   "",
+					"3_c.up.sql":   "",
+				})
+				opts := dbmate.ImportOptions{From: dbmate.ImportGolangMigrate, Dir: dir, SkipFiles: true}
+
+				// the default history table is also the dbmate migrations table
+				err := db.Import(opts)
+				require.EqualError(t, err, "the golang-migrate history table `schema_migrations` is also the dbmate migrations table, use a different migrations table")
+
+				opts.HistoryTable = "golang_migrations"
+				_, err = sqlDB.Exec("create table golang_migrations (version bigint, dirty boolean)")
+				require.NoError(t, err)
+				_, err = sqlDB.Exec("insert into golang_migrations (version, dirty) values (2, true)")
+				require.NoError(t, err)
+
+				err = db.Import(opts)
+				require.ErrorIs(t, err, dbmate.ErrImportDirty)
+
+				_, err = sqlDB.Exec("update golang_migrations set dirty = false")
+				require.NoError(t, err)
+				err = db.Import(opts)
+				require.NoError(t, err)
+				require.Equal(t, []string{"00001", "00002", "1", "10", "11", "2"}, applied())
+			})
+		})
+	}
+}
+
+// schemaWriter records files written by dbmate
+type schemaWriter map[string][]byte
+
+func (w schemaWriter) MkdirAll(string) error { return nil }
+
+func (w schemaWriter) WriteFile(name string, data []byte) error {
+	w[name] = data
+	return nil
+}
+
+func (w schemaWriter) Rename(string, string) error { return nil }
+
+func TestDumpSchemaWriter(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.FS = fstest.MapFS{
+				"db/migrations/001_test_migration.sql": {
+					Data: []byte("-- migrate:up\ncreate table writer_a (id int);\n-- migrate:down\ndrop table writer_a;\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			// schema dumps can be discarded
+			db.Writer = dbmate.DiscardWriter{}
+			err = db.DumpSchema()
+			require.NoError(t, err)
+
+			db.AutoDumpSchema = true
+			err = db.Migrate()
+			require.NoError(t, err)
+
+			// schema dumps can be sent to a custom writer
+			writer := schemaWriter{}
+			db.Writer = writer
+			err = db.DumpSchema()
+			require.NoError(t, err)
+			require.Contains(t, string(writer[db.SchemaFile]), "writer_a")
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.Log = io.Discard
+			db.FS = fstest.MapFS{
+				"db/migrations/001_create_colors.sql": {
+					Data: []byte("-- migrate:up\ncreate table colors (name varchar(50));\n-- migrate:down\ndrop table colors;\n"),
+				},
+				"db/seeds/01_red.sql":              {Data: []byte("insert into colors (name) values ('red');")},
+				"db/seeds/03_blue.sql":             {Data: []byte("insert into colors (name) values ('blue');")},
+				"db/seeds/README.md":               {Data: []byte("# seeds\n")},
+				"db/seeds/development/02_pink.sql": {Data: []byte("insert into colors (name) values ('pink');")},
+				"db/seeds/production/02_gray.sql":  {Data: []byte("insert into colors (name) values ('gray');")},
+			}
+			drv, err := db.Driver()
+			require.NoError(t, err)
+
+			// drop, recreate and migrate database
+			err = db.Drop()
+			require.NoError(t, err)
+			err = db.CreateAndMigrate()
+			require.NoError(t, err)
+
+			sqlDB, err := drv.Open()
+			require.NoError(t, err)
+			defer dbutil.MustClose(sqlDB)
+
+			colors := func() []string {
+				rows, err := sqlDB.Query("select name from colors")
+				require.NoError(t, err)
+				defer dbutil.MustClose(rows)
+				result := []string{}
+				for rows.Next() {
+					var name string
+					require.NoError(t, rows.Scan(&name))
+					result = append(result, name)
+				}
+				require.NoError(t, rows.Err())
+				sort.Strings(result)
+				return result
+			}
+
+			// environment seeds are only applied to their environment
+			db.Environment = "development"
+			err = db.Seed(dbmate.SeedOptions{})
+			require.NoError(t, err)
+			require.Equal(t, []string{"blue", "pink", "red"}, colors())
+
+			// applied seeds are recorded in the seeds table, not the migrations table
+			seeds := 0
+			err = sqlDB.QueryRow("select count(*) from schema_seeds").Scan(&seeds)
+			require.NoError(t, err)
+			require.Equal(t, 3, seeds)
+			applied, err := drv.SelectMigrations(sqlDB, -1)
+			require.NoError(t, err)
+			require.Equal(t, map[string]bool{"001": true}, applied)
+
+			// applied seeds do not run again
+			err = db.Seed(dbmate.SeedOptions{})
+			require.NoError(t, err)
+			require.Equal(t, []string{"blue", "pink", "red"}, colors())
+
+			// reset runs every seed again
+			err = db.Seed(dbmate.SeedOptions{Reset: true})
+			require.NoError(t, err)
+			require.Equal(t, []string{"blue", "blue", "pink", "pink", "red", "red"}, colors())
+
+			// a failed seed is rolled back and not recorded
+			db.FS.(fstest.MapFS)["db/seeds/04_invalid.sql"] = &fstest.MapFile{
+				Data: []byte("insert into colors (name) values ('green'); insert into missing_table values (1);"),
+			}
+			err = db.Seed(dbmate.SeedOptions{})
+			require.ErrorContains(t, err, "db/seeds/04_invalid.sql")
+			require.Equal(t, []string{"blue", "blue", "pink", "pink", "red", "red"}, colors())
+
+			// missing seeds directory
+			db.SeedsDir = "db/missing"
+			err = db.Seed(dbmate.SeedOptions{})
+			require.ErrorIs(t, err, dbmate.ErrSeedsDirNotFound)
+		})
+	}
+}
+
+func TestMigrateDuplicateVersions(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.AutoDumpSchema = false
+			db.MigrationsDir = []string{"db/migrations", "db/overrides"}
+			db.VersionCollision = dbmate.CollisionLast
+			db.FS = fstest.MapFS{
+				"db/migrations/001_create_users.sql": {
+					Data: []byte("-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+				},
+				"db/overrides/001_create_people.sql": {
+					Data: []byte("-- migrate:up\ncreate table people (id int);\n-- migrate:down\ndrop table people;\n"),
+				},
+			}
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			// the unused migration is reported once
+			output := capturer.CaptureOutput(func() {
+				db.Log = os.Stdout
+				err = db.Migrate()
+			})
+			require.NoError(t, err)
+			require.Equal(t, 1, strings.Count(output, "Skipping duplicate version: db/migrations/001_create_users.sql"))
+			require.Contains(t, output, "Applying: 001_create_people.sql")
+		})
+	}
+}
+
+func TestMigrateEnvironment(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.AutoDumpSchema = false
+			db.FS = fstest.MapFS{
+				"db/migrations/001_create_colors.sql": {
+					Data: []byte("-- migrate:up\ncreate table colors (name varchar(50));\n-- migrate:down\ndrop table colors;\n"),
+				},
+				"db/migrations/002_insert_colors.sql": {
+					Data: []byte("-- migrate:up env:production,staging\ninsert into colors (name) values ('red');\n-- migrate:down\ndelete from colors;\n"),
+				},
+			}
+			drv, err := db.Driver()
+			require.NoError(t, err)
+
+			// drop and recreate database
+			err = db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+
+			// migrations for other environments are skipped
+			db.Environment = "development"
+			output := capturer.CaptureOutput(func() {
+				db.Log = os.Stdout
+				err = db.Migrate()
+			})
+			require.NoError(t, err)
+			require.Contains(t, output, "Skipping: 002_insert_colors.sql (only for environment production, staging, current environment is development)")
+
+			sqlDB, err := drv.Open()
+			require.NoError(t, err)
+			defer dbutil.MustClose(sqlDB)
+
+			applied, err := drv.SelectMigrations(sqlDB, -1)
+			require.NoError(t, err)
+			require.Equal(t, map[string]bool{"001": true}, applied)
+
+			output = capturer.CaptureOutput(func() {
+				db.Log = os.Stdout
+				_, err = db.Status(false)
+			})
+			require.NoError(t, err)
+			require.Contains(t, output, `[X] 001_create_colors.sql
+[-] 002_insert_colors.sql (skipped: only for environment production, staging, current environment is development)
+
+Applied: 1
+Pending: 0
+Skipped: 1`)
+
+			summary, err := db.Summary()
+			require.NoError(t, err)
+			require.Equal(t, 1, summary.Skipped)
+			require.Equal(t, 0, summary.Pending)
+
+			// migrations for the current environment are applied
+			db.Environment = "staging"
+			db.Log = io.Discard
+			err = db.Migrate()
+			require.NoError(t, err)
+
+			count := 0
+			err = sqlDB.QueryRow("select count(*) from colors").Scan(&count)
+			require.NoError(t, err)
+			require.Equal(t, 1, count)
+		})
+	}
+}
+
+func TestMigrateDatabases(t *testing.T) {
+	dir := t.TempDir()
+	urls := []*url.URL{
+		dbutil.MustParseURL("sqlite3:" + filepath.Join(dir, "one.sqlite3")),
+		dbutil.MustParseURL("sqlite3:" + filepath.Join(dir, "missing", "two.sqlite3")),
+		dbutil.MustParseURL("sqlite3:" + filepath.Join(dir, "three.sqlite3")),
+	}
+
+	newDB := func() (*dbmate.DB, *bytes.Buffer) {
+		output := &bytes.Buffer{}
+		db := dbmate.New(nil)
+		db.Log = output
+		db.FS = fstest.MapFS{
+			"db/migrations/001_create_colors.sql": {
+				Data: []byte("-- migrate:up\ncreate table colors (name varchar(50));\n-- migrate:down\ndrop table colors;\n"),
+			},
+		}
+		return db, output
+	}
+
+	t.Run("fail fast", func(t *testing.T) {
+		db, output := newDB()
+		results, err := db.MigrateDatabases(urls, dbmate.DatabasesOptions{})
+		require.ErrorIs(t, err, dbmate.ErrDatabasesFailed)
+		require.EqualError(t, err, "failed for some databases: 1 failed, 1 skipped of 3")
+
+		require.NoError(t, results[0].Err)
+		require.Equal(t, 1, results[0].Summary.Applied)
+		require.Error(t, results[1].Err)
+		require.True(t, results[2].Skipped)
+		require.Contains(t, output.String(), "==> sqlite3:"+filepath.Join(dir, "one.sqlite3")+"\nApplying: 001_create_colors.sql\n")
+		require.Contains(t, output.String(), "[ok] sqlite3:"+filepath.Join(dir, "one.sqlite3")+": applied 1, pending 0\n")
+		require.Contains(t, output.String(), "[skipped] sqlite3:"+filepath.Join(dir, "three.sqlite3")+": not started after an earlier failure\n")
+		require.Contains(t, output.String(), "\nDatabases: 3\nFailed: 1\nSkipped: 1\n")
+	})
+
+	t.Run("continue on error", func(t *testing.T) {
+		db, _ := newDB()
+		results, err := db.MigrateDatabases(urls, dbmate.DatabasesOptions{Parallelism: 3, ContinueOnError: true})
+		require.EqualError(t, err, "failed for some databases: 1 failed, 0 skipped of 3")
+		require.Error(t, results[1].Err)
+		require.Equal(t, 1, results[2].Summary.Applied)
+
+		// already migrated databases have nothing pending
+		results, err = db.StatusDatabases([]*url.URL{urls[0], urls[2]}, dbmate.DatabasesOptions{Parallelism: 2})
+		require.NoError(t, err)
+		for _, result := range results {
+			require.Equal(t, &dbmate.Summary{Applied: 1, LastApplied: "001"}, result.Summary)
+		}
+	})
+}
+
+func TestMigrateSchemas(t *testing.T) {
+	u := dbutil.MustParseURL(os.Getenv("POSTGRES_TEST_URL"))
+	db := newTestDB(t, u)
+	db.AutoDumpSchema = false
+	db.FS = fstest.MapFS{
+		"db/migrations/001_create_colors.sql": {
+			Data: []byte("-- migrate:up\ncreate table colors (name varchar(50));\n-- migrate:down\ndrop table colors;\n"),
+		},
+	}
+	drv, err := db.Driver()
+	require.NoError(t, err)
+
+	// drop and recreate database
+	err = db.Drop()
+	require.NoError(t, err)
+	err = db.Create()
+	require.NoError(t, err)
+
+	results, err := db.MigrateSchemas([]string{"tenant_a", "tenant_b"}, dbmate.DatabasesOptions{Parallelism: 2})
+	require.NoError(t, err)
+	require.Equal(t, "tenant_a", results[0].Name)
+	require.Equal(t, 1, results[0].Summary.Applied)
+
+	// each schema has its own tables and migrations table
+	sqlDB, err := drv.Open()
+	require.NoError(t, err)
+	defer dbutil.MustClose(sqlDB)
+	for _, table := range []string{"tenant_a.colors", "tenant_a.schema_migrations", "tenant_b.colors", "tenant_b.schema_migrations"} {
+		_, err := sqlDB.Exec("select * from " + table)
+		require.NoError(t, err)
+	}
+	_, err = sqlDB.Exec("select * from public.colors")
+	require.Error(t, err)
+
+	// new schemas are reported as pending
+	schemas, err := db.QuerySchemas(context.Background(), "select nspname from pg_namespace where nspname like 'tenant_%' union select 'tenant_c' order by 1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"tenant_a", "tenant_b", "tenant_c"}, schemas)
+
+	results, err = db.StatusSchemas(schemas, dbmate.DatabasesOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, results[1].Summary.Pending)
+	require.Equal(t, 1, results[2].Summary.Pending)
+}
+
+func TestMigrateDependencies(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.AutoDumpSchema = false
+			db.Log = io.Discard
+			db.Strict = true
+			mapFS := fstest.MapFS{
+				"db/migrations/001_create_users.sql": {
+					Data: []byte("-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+				},
+				"db/migrations/003_create_orders.sql": {
+					Data: []byte("-- depends: 001_create_users\n-- migrate:up\ncreate table orders (id int);\n-- migrate:down\ndrop table orders;\n"),
+				},
+			}
+			db.FS = mapFS
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+			err = db.Migrate()
+			require.NoError(t, err)
+
+			// an older migration which no applied migration depends on may be applied in --strict mode
+			mapFS["db/migrations/002_create_tags.sql"] = &fstest.MapFile{
+				Data: []byte("-- migrate:up\ncreate table tags (id int);\n-- migrate:down\ndrop table tags;\n"),
+			}
+			summary, err := db.Summary()
+			require.NoError(t, err)
+			require.Empty(t, summary.OutOfOrder)
+			err = db.Migrate()
+			require.NoError(t, err)
+
+			// but not one which an applied migration depends on
+			mapFS["db/migrations/004_create_payments.sql"] = &fstest.MapFile{
+				Data: []byte("-- migrate:up\ncreate table payments (id int);\n-- migrate:down\ndrop table payments;\n"),
+			}
+			mapFS["db/migrations/003_create_orders.sql"].Data = []byte("-- depends: 001_create_users, 004_create_payments\n-- migrate:up\ncreate table orders (id int);\n-- migrate:down\ndrop table orders;\n")
+
+			summary, err = db.Summary()
+			require.NoError(t, err)
+			require.Equal(t, []string{"004"}, summary.OutOfOrder)
+			err = db.Migrate()
+			require.EqualError(t, err, "migration `004` is out of order with already applied migrations, the applied migration `003` depends on it in --strict mode")
+
+			// status lists migrations in dependency order, with their dependencies
+			output := &bytes.Buffer{}
+			db.Log = output
+			_, err = db.Status(false)
+			require.NoError(t, err)
+			require.Equal(t, `[X] 001_create_users.sql
+[X] 002_create_tags.sql
+[ ] 004_create_payments.sql
+[X] 003_create_orders.sql <- 001_create_users, 004_create_payments
+
+Applied: 3
+Pending: 1
+`, output.String())
+		})
+	}
+}
+
+func TestMigrateOutOfOrder(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			db := newTestDB(t, u)
+			db.AutoDumpSchema = false
+			db.Log = io.Discard
+			mapFS := fstest.MapFS{
+				"db/migrations/001_create_users.sql": {
+					Data: []byte("-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+				},
+				"db/migrations/005_create_orders.sql": {
+					Data: []byte("-- migrate:up\ncreate table orders (id int);\n-- migrate:down\ndrop table orders;\n"),
+				},
+			}
+			db.FS = mapFS
+
+			// drop and recreate database
+			err := db.Drop()
+			require.NoError(t, err)
+			err = db.Create()
+			require.NoError(t, err)
+			err = db.Migrate()
+			require.NoError(t, err)
+
+			mapFS["db/migrations/003_create_tags.sql"] = &fstest.MapFile{
+				Data: []byte("-- migrate:up\ncreate table tags (id int);\n-- migrate:down\ndrop table tags;\n"),
+			}
+			mapFS["db/migrations/004_create_payments.sql"] = &fstest.MapFile{
+				Data: []byte("-- migrate:up allow_out_of_order:true\ncreate table payments (id int);\n-- migrate:down\ndrop table payments;\n"),
+			}
+
+			// overridden migrations are not reported as drift
+			summary, err := db.Summary()
+			require.NoError(t, err)
+			require.Equal(t, []string{"003"}, summary.OutOfOrder)
+
+			// fail applies nothing
+			db.AllowOutOfOrder = dbmate.OutOfOrderFail
+			err = db.Migrate()
+			require.EqualError(t, err, "migration `003` is out of order with already applied migrations, the version number has to be higher than the applied migration `005` with --allow-out-of-order=fail")
+			summary, err = db.Summary()
+			require.NoError(t, err)
+			require.Equal(t, 2, summary.Pending)
+
+			// warn lists each out of order migration, except overridden migrations
+			db.AllowOutOfOrder = dbmate.OutOfOrderWarn
+			output := &bytes.Buffer{}
+			db.Log = output
+			err = db.Migrate()
+			require.NoError(t, err)
+			require.Equal(t, `Applying out of order: 003_create_tags.sql (after applied migration 005)
+Applying: 003_create_tags.sql
+Applying: 004_create_payments.sql
+`, output.String())
+		})
+	}
+}
+
+func TestMigrateBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "app.sqlite3")
+	backupDir := filepath.Join(dir, "backups")
+
+	output := &bytes.Buffer{}
+	db := dbmate.New(dbutil.MustParseURL("sqlite3:" + dbPath))
+	db.AutoDumpSchema = false
+	db.Log = output
+	db.BackupDir = backupDir
+	mapFS := fstest.MapFS{
+		"db/migrations/001_create_users.sql": {
+			Data: []byte("-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+		},
+	}
+	db.FS = mapFS
+
+	// databases which are not protected are not backed up
+	err := db.Migrate()
+	require.NoError(t, err)
+	require.NoDirExists(t, backupDir)
+
+	// protected databases are backed up before applying migrations
+	db.ProtectedDatabases = []string{db.DatabaseName()}
+	mapFS["db/migrations/002_create_posts.sql"] = &fstest.MapFile{
+		Data: []byte("-- migrate:up\ncreate table posts (id int);\n-- migrate:down\ndrop table posts;\n"),
+	}
+	output.Reset()
+	err = db.Migrate()
+	require.NoError(t, err)
+	backups, err := filepath.Glob(filepath.Join(backupDir, "app.sqlite3-*.backup"))
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	require.Equal(t, "Backing up: "+backups[0]+"\nApplying: 002_create_posts.sql\n", output.String())
+
+	// the backup contains the database before migrating
+	backupDB := dbmate.New(dbutil.MustParseURL("sqlite3:" + backups[0]))
+	backupDB.FS = db.FS
+	migrations, err := backupDB.FindMigrations()
+	require.NoError(t, err)
+	require.True(t, migrations[0].Applied)
+	require.False(t, migrations[1].Applied)
+
+	// nothing is backed up when there are no pending migrations
+	output.Reset()
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Empty(t, output.String())
+
+	// a failed backup aborts the migration
+	mapFS["db/migrations/003_create_tags.sql"] = &fstest.MapFile{
+		Data: []byte("-- migrate:up\ncreate table tags (id int);\n-- migrate:down\ndrop table tags;\n"),
+	}
+	db.BackupDir = filepath.Join(backups[0], "nested")
+	err = db.Migrate()
+	require.ErrorIs(t, err, dbmate.ErrBackupFailed)
+	summary, err := db.Summary()
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Pending)
+}
+
+func TestTestMigrations(t *testing.T) {
+	for _, u := range testURLs() {
+		t.Run(u.Scheme, func(t *testing.T) {
+			// the database being migrated must never be dropped
+			liveURL := *u
+			liveURL.Path += "_live"
+			live := newTestDB(t, &liveURL)
+			err := live.Drop()
+			require.NoError(t, err)
+			err = live.Create()
+			require.NoError(t, err)
+			defer func() {
+				require.NoError(t, live.Drop())
+			}()
+
+			db := newTestDB(t, &liveURL)
+			db.AutoDumpSchema = false
+			output := &bytes.Buffer{}
+			db.Log = output
+			mapFS := fstest.MapFS{
+				"db/migrations/001_create_users.sql": {
+					Data: []byte("-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+				},
+				"db/migrations/002_create_posts.sql": {
+					Data: []byte("-- migrate:up\ncreate table posts (id int);\ncreate table comments (id int);\n-- migrate:down\ndrop table comments;\ndrop table posts;\n"),
+				},
+			}
+			db.FS = mapFS
+
+			// a scratch database is required, and must not be the database being migrated
+			err = db.TestMigrations()
+			require.ErrorIs(t, err, dbmate.ErrNoScratchURL)
+			db.ScratchURL = &liveURL
+			err = db.TestMigrations()
+			require.ErrorIs(t, err, dbmate.ErrScratchIsDatabase)
+
+			db.ScratchURL = u
+			err = db.TestMigrations()
+			require.NoError(t, err)
+			drv, err := live.Driver()
+			require.NoError(t, err)
+			exists, err := drv.DatabaseExists()
+			require.NoError(t, err)
+			require.True(t, exists)
+			sqlDB, err := drv.Open()
+			require.NoError(t, err)
+			defer dbutil.MustClose(sqlDB)
+			exists, err = drv.MigrationsTableExists(sqlDB)
+			require.NoError(t, err)
+			require.False(t, exists)
+			require.Contains(t, output.String(), `Applying: 001_create_users.sql
+Rolling back: 001_create_users.sql
+Applying: 001_create_users.sql
+Applying: 002_create_posts.sql
+Rolling back: 002_create_posts.sql
+Applying: 002_create_posts.sql
+Tested: 2 migrations
+`, output.String())
+
+			// the first migration which is not reversed is reported
+			mapFS["db/migrations/002_create_posts.sql"] = &fstest.MapFile{
+				Data: []byte("-- migrate:up\ncreate table posts (id int);\ncreate table comments (id int);\n-- migrate:down\ndrop table posts;\n"),
+			}
+			mapFS["db/migrations/003_create_tags.sql"] = &fstest.MapFile{
+				Data: []byte("-- migrate:up\ncreate table tags (id int);\n-- migrate:down\n"),
+			}
+			err = db.TestMigrations()
+			require.ErrorIs(t, err, dbmate.ErrRoundTripFailed)
+			require.ErrorContains(t, err, "rolling back migration did not restore the schema `002_create_posts.sql`:\n+ ")
+			require.ErrorContains(t, err, "comments")
+
+			// migrations without a down block fail
+			delete(mapFS, "db/migrations/002_create_posts.sql")
+			err = db.TestMigrations()
+			require.EqualError(t, err, "rolling back migration did not restore the schema `003_create_tags.sql`: the down block is empty")
+		})
+	}
+}
+
+func TestMigrateLegacyDriver(t *testing.T) {
+	// a driver which only implements Driver, and not ContextDriver
+	dbmate.RegisterDriver(func(config dbmate.DriverConfig) dbmate.Driver {
+		return struct{ dbmate.Driver }{sqlite.NewDriver(config)}
+	}, "sqlite-legacy")
+
+	db := dbmate.New(dbutil.MustParseURL("sqlite-legacy:" + filepath.Join(t.TempDir(), "app.sqlite3")))
+	db.AutoDumpSchema = false
+	db.Log = io.Discard
+	db.FS = fstest.MapFS{
+		"db/migrations/001_create_users.sql": {
+			Data: []byte("-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+		},
+	}
+
+	err := db.CreateAndMigrate()
+	require.NoError(t, err)
+	summary, err := db.Summary()
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Applied)
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	summary, err = db.Summary()
+	require.NoError(t, err)
+	require.Equal(t, 0, summary.Applied)
+
+	err = db.Drop()
+	require.NoError(t, err)
+}
+
+func TestMigrateTimeoutsUnsupported(t *testing.T) {
+	// a driver which only implements Driver, and not TimeoutDriver
+	dbmate.RegisterDriver(func(config dbmate.DriverConfig) dbmate.Driver {
+		return struct{ dbmate.Driver }{sqlite.NewDriver(config)}
+	}, "sqlite-no-timeouts")
+
+	db := dbmate.New(dbutil.MustParseURL("sqlite-no-timeouts:" + filepath.Join(t.TempDir(), "app.sqlite3")))
+	db.AutoDumpSchema = false
+	db.Log = io.Discard
+	db.StatementTimeout = time.Second
+	db.FS = fstest.MapFS{
+		"db/migrations/001_create_users.sql": {
+			Data: []byte("-- migrate:up lock_timeout:5s\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+		},
+	}
+
+	// timeouts are ignored
+	err := db.Migrate()
+	require.NoError(t, err)
+	summary, err := db.Summary()
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Applied)
+}
@@ -0,0 +1,280 @@
+package dbmate
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Error codes
+var (
+	ErrMissingDependency = errors.New("migration depends on a migration which does not exist")
+	ErrDependencyCycle   = errors.New("migration dependencies contain a cycle")
+)
+
+// dependsRegExp matches dependency declarations, e.g. "-- depends: 20240101_users"
+var dependsRegExp = regexp.MustCompile(`(?m)^--\s*depends:(.*)$`)
+
+// parseDepends returns the dependencies declared in migration contents. Several
+// dependencies may be separated by commas or whitespace, or declared on several lines.
+func parseDepends(contents string) []string {
+	var depends []string
+	for _, match := range dependsRegExp.FindAllStringSubmatch(contents, -1) {
+		depends = append(depends, strings.FieldsFunc(match[1], func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t' || r == '\r'
+		})...)
+	}
+
+	return depends
+}
+
+// migrationName returns the name used to refer to a migration in dependencies,
+// which is the file name without the .sql, .up.sql or .down.sql suffix
+func migrationName(migration *Migration) string {
+	name := migration.FileName
+	for _, suffix := range []string{".up.sql", ".down.sql", ".sql"} {
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix)
+		}
+	}
+
+	return name
+}
+
+// hasDependencies returns true if any migration declares dependencies
+func hasDependencies(migrations []Migration) bool {
+	for _, migration := range migrations {
+		if len(migration.Depends) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readDependencies sets Depends for each migration. Files which cannot be read are
+// left without dependencies, so that the error is reported when they are applied.
+func readDependencies(migrations []Migration) {
+	for i := range migrations {
+		contents, err := migrations[i].readFile()
+		if err != nil {
+			continue
+		}
+		migrations[i].Depends = parseDepends(contents)
+	}
+}
+
+// migrationIndexes returns the index of each migration by version, and by file name
+// without the .sql suffix
+func migrationIndexes(migrations []Migration) map[string]int {
+	indexes := map[string]int{}
+	for i := range migrations {
+		indexes[migrations[i].Version] = i
+		indexes[migrationName(&migrations[i])] = i
+	}
+
+	return indexes
+}
+
+// resolveDependencies returns the indexes of the dependencies of each migration.
+// A dependency refers to a migration by version, or by file name without the
+// .sql suffix. Dependencies on otherDrivers (migrations for another driver) are
+// not ordered, and are returned by the index of the dependent migration instead.
+// A problem is returned for each dependency which does not exist.
+func resolveDependencies(migrations []Migration, otherDrivers []Migration) ([][]int, map[int][]string, []*ValidationError) {
+	indexes := migrationIndexes(migrations)
+	others := migrationIndexes(otherDrivers)
+
+	deps := make([][]int, len(migrations))
+	external := map[int][]string{}
+	problems := []*ValidationError{}
+	for i, migration := range migrations {
+		for _, dep := range migration.Depends {
+			if j, ok := indexes[dep]; ok {
+				deps[i] = append(deps[i], j)
+				continue
+			}
+			if _, ok := others[dep]; ok {
+				external[i] = append(external[i], dep)
+				continue
+			}
+
+			problems = append(problems, &ValidationError{
+				FilePath: migration.FilePath,
+				Err:      fmt.Errorf("%w `%s`", ErrMissingDependency, dep),
+			})
+		}
+	}
+
+	return deps, external, problems
+}
+
+// sortDependencies returns migrations in topological order, so that each migration
+// follows its dependencies. Otherwise, the existing order is kept. If the dependencies
+// contain a cycle, a problem is returned describing the cycle.
+func sortDependencies(migrations []Migration, deps [][]int) ([]Migration, *ValidationError) {
+	dependents := make([][]int, len(migrations))
+	remaining := make([]int, len(migrations))
+	for i := range deps {
+		remaining[i] = len(deps[i])
+		for _, j := range deps[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+	}
+
+	// always take the earliest available migration, to keep the existing order where possible
+	available := &intHeap{}
+	for i := range migrations {
+		if remaining[i] == 0 {
+			heap.Push(available, i)
+		}
+	}
+
+	sorted := make([]Migration, 0, len(migrations))
+	for available.Len() > 0 {
+		i := heap.Pop(available).(int)
+		sorted = append(sorted, migrations[i])
+		for _, j := range dependents[i] {
+			remaining[j]--
+			if remaining[j] == 0 {
+				heap.Push(available, j)
+			}
+		}
+	}
+
+	if len(sorted) < len(migrations) {
+		cycle := findCycle(migrations, deps, remaining)
+		names := make([]string, len(cycle))
+		for k, i := range cycle {
+			names[k] = migrationName(&migrations[i])
+		}
+		return nil, &ValidationError{
+			FilePath: migrations[cycle[0]].FilePath,
+			Err:      fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(names, " -> ")),
+		}
+	}
+
+	return sorted, nil
+}
+
+// findCycle returns the indexes of a cycle among the migrations which could not be
+// sorted, starting and ending with the same migration
+func findCycle(migrations []Migration, deps [][]int, remaining []int) []int {
+	start := -1
+	for i := range migrations {
+		if remaining[i] > 0 {
+			start = i
+			break
+		}
+	}
+
+	// follow unsorted dependencies until a migration is visited twice
+	visited := map[int]int{}
+	path := []int{}
+	for i := start; ; {
+		if k, ok := visited[i]; ok {
+			return append(path[k:], i)
+		}
+		visited[i] = len(path)
+		path = append(path, i)
+
+		for _, j := range deps[i] {
+			if remaining[j] > 0 {
+				i = j
+				break
+			}
+		}
+	}
+}
+
+// orderMigrations reads the dependencies of each migration, and returns migrations in
+// topological order. Migrations without dependencies keep their existing order.
+// Migrations which depend on otherDrivers (migrations for another driver, which are
+// never applied to this database) are skipped.
+func orderMigrations(migrations []Migration, otherDrivers []Migration) ([]Migration, error) {
+	readDependencies(migrations)
+	if !hasDependencies(migrations) {
+		return migrations, nil
+	}
+
+	deps, external, problems := resolveDependencies(migrations, otherDrivers)
+	if len(problems) > 0 {
+		errs := []error{}
+		for _, problem := range problems {
+			errs = append(errs, problem)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	for i, names := range external {
+		migrations[i].SkipReason = fmt.Sprintf("depends on %s, which is for another driver", strings.Join(names, ", "))
+	}
+
+	sorted, problem := sortDependencies(migrations, deps)
+	if problem != nil {
+		return nil, problem
+	}
+
+	return sorted, nil
+}
+
+// dependencySkipReason returns why a migration is skipped because one of its dependencies
+// is skipped, or an empty string. indexes are from migrationIndexes.
+func dependencySkipReason(migrations []Migration, indexes map[string]int, i int) string {
+	for _, dep := range migrations[i].Depends {
+		if j, ok := indexes[dep]; ok && !migrations[j].Applied && migrations[j].SkipReason != "" {
+			return "depends on skipped migration " + dep
+		}
+	}
+
+	return ""
+}
+
+// appliedDependents returns, for each pending migration which an applied migration
+// depends on (directly or indirectly), the version of that applied migration
+func appliedDependents(migrations []Migration) map[string]string {
+	deps, _, _ := resolveDependencies(migrations, nil)
+	result := map[string]string{}
+	for i, migration := range migrations {
+		if !migration.Applied {
+			continue
+		}
+
+		visited := map[int]bool{}
+		stack := append([]int{}, deps[i]...)
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if visited[j] {
+				continue
+			}
+			visited[j] = true
+
+			if !migrations[j].Applied && migrations[j].SkipReason == "" {
+				if _, ok := result[migrations[j].Version]; !ok {
+					result[migrations[j].Version] = migration.Version
+				}
+			}
+			stack = append(stack, deps[j]...)
+		}
+	}
+
+	return result
+}
+
+// intHeap is a min-heap of ints
+type intHeap []int
+
+func (h intHeap) Len() int           { return len(h) }
+func (h intHeap) Less(i, j int) bool { return h[i] < h[j] }
+func (h intHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *intHeap) Push(x any)        { *h = append(*h, x.(int)) }
+
+func (h *intHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
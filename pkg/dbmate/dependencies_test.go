@@ -0,0 +1,122 @@
+package dbmate
+
+import (
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDepends(t *testing.T) {
+	contents := "-- depends: 001_users, 002\n-- depends:003_tags\n-- migrate:up\n-- migrate:down\n"
+	require.Equal(t, []string{"001_users", "002", "003_tags"}, parseDepends(contents))
+	require.Nil(t, parseDepends("-- migrate:up\n-- migrate:down\n"))
+}
+
+func TestOrderMigrations(t *testing.T) {
+	migration := func(depends string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(depends + "\n-- migrate:up\n-- migrate:down\n")}
+	}
+	newDB := func(mapFS fstest.MapFS) *DB {
+		db := New(nil)
+		db.Log = io.Discard
+		db.FS = mapFS
+		return db
+	}
+	names := func(migrations []Migration) []string {
+		result := []string{}
+		for _, migration := range migrations {
+			result = append(result, migration.FileName)
+		}
+		return result
+	}
+
+	t.Run("topological order", func(t *testing.T) {
+		db := newDB(fstest.MapFS{
+			"db/migrations/001_users.sql":         migration(""),
+			"db/migrations/002_orders.sql":        migration("-- depends: 004_products 001_users"),
+			"db/migrations/003_tags.sql":          migration(""),
+			"db/migrations/004_products.up.sql":   {Data: []byte("-- depends: 001\n-- migrate:up\n")},
+			"db/migrations/004_products.down.sql": {Data: []byte("-- migrate:down\n")},
+		})
+
+		migrations, err := db.migrationFiles()
+		require.NoError(t, err)
+		require.Equal(t, []string{"001_users.sql", "003_tags.sql", "004_products.up.sql", "002_orders.sql"}, names(migrations))
+		require.Equal(t, []string{"004_products", "001_users"}, migrations[3].Depends)
+
+		problems, err := db.Validate()
+		require.NoError(t, err)
+		require.Empty(t, problems)
+	})
+
+	t.Run("missing dependency", func(t *testing.T) {
+		db := newDB(fstest.MapFS{
+			"db/migrations/001_users.sql":  migration(""),
+			"db/migrations/002_orders.sql": migration("-- depends: 001_customers"),
+		})
+
+		_, err := db.migrationFiles()
+		require.ErrorIs(t, err, ErrMissingDependency)
+		require.EqualError(t, err, "db/migrations/002_orders.sql: migration depends on a migration which does not exist `001_customers`")
+
+		problems, err := db.Validate()
+		require.NoError(t, err)
+		require.Len(t, problems, 1)
+		require.ErrorIs(t, problems[0], ErrMissingDependency)
+	})
+
+	t.Run("skipped dependency", func(t *testing.T) {
+		db := newDB(fstest.MapFS{
+			"db/migrations/001_extension.sql": {Data: []byte("-- migrate:up driver:postgres\n-- migrate:down\n")},
+			"db/migrations/002_users.sql":     migration("-- depends: 001_extension"),
+			"db/migrations/003_fixtures.sql":  {Data: []byte("-- migrate:up env:development\n-- migrate:down\n")},
+			"db/migrations/004_orders.sql":    migration("-- depends: 003_fixtures"),
+			"db/migrations/005_payments.sql":  migration("-- depends: 004_orders"),
+			"db/migrations/006_tags.sql":      migration(""),
+		})
+		db.DatabaseURL = dbutil.MustParseURL("sqlite:test.sqlite3")
+		db.Environment = "production"
+
+		// dependencies on migrations for another driver are not missing
+		migrations, err := db.migrationFiles()
+		require.NoError(t, err)
+		db.markSkipped(migrations)
+
+		reasons := map[string]string{}
+		for _, migration := range migrations {
+			reasons[migration.FileName] = migration.SkipReason
+		}
+		require.Equal(t, map[string]string{
+			"002_users.sql":    "depends on 001_extension, which is for another driver",
+			"003_fixtures.sql": "only for environment development, current environment is production",
+			"004_orders.sql":   "depends on skipped migration 003_fixtures",
+			"005_payments.sql": "depends on skipped migration 004_orders",
+			"006_tags.sql":     "",
+		}, reasons)
+
+		problems, err := db.Validate()
+		require.NoError(t, err)
+		require.Empty(t, problems)
+	})
+
+	t.Run("cycle", func(t *testing.T) {
+		db := newDB(fstest.MapFS{
+			"db/migrations/001_users.sql":    migration(""),
+			"db/migrations/002_orders.sql":   migration("-- depends: 003_payments"),
+			"db/migrations/003_payments.sql": migration("-- depends: 004_invoices"),
+			"db/migrations/004_invoices.sql": migration("-- depends: 002_orders, 001_users"),
+		})
+
+		_, err := db.migrationFiles()
+		require.ErrorIs(t, err, ErrDependencyCycle)
+		require.EqualError(t, err, "db/migrations/002_orders.sql: migration dependencies contain a cycle: 002_orders -> 003_payments -> 004_invoices -> 002_orders")
+
+		problems, err := db.Validate()
+		require.NoError(t, err)
+		require.Len(t, problems, 1)
+		require.ErrorIs(t, problems[0], ErrDependencyCycle)
+	})
+}
@@ -1,10 +1,14 @@
 package dbmate
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"io"
+	"log/slog"
 	"net/url"
+	"os"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
 )
@@ -25,13 +29,105 @@ type Driver interface {
 	QueryError(string, error) error
 }
 
+// ContextDriver is implemented by drivers whose operations can be canceled with a context.
+// Drivers which only implement Driver run to completion when the context is canceled.
+type ContextDriver interface {
+	DatabaseExistsContext(context.Context) (bool, error)
+	CreateDatabaseContext(context.Context) error
+	DropDatabaseContext(context.Context) error
+	DumpSchemaContext(context.Context, *sql.DB) ([]byte, error)
+	MigrationsTableExistsContext(context.Context, *sql.DB) (bool, error)
+	CreateMigrationsTableContext(context.Context, *sql.DB) error
+	SelectMigrationsContext(context.Context, *sql.DB, int) (map[string]bool, error)
+	InsertMigrationContext(context.Context, dbutil.Transaction, string) error
+	DeleteMigrationContext(context.Context, dbutil.Transaction, string) error
+	PingContext(context.Context) error
+}
+
+// contextDriver returns drv as a ContextDriver, ignoring the context if drv does not
+// implement it
+func contextDriver(drv Driver) ContextDriver {
+	if ctxDrv, ok := drv.(ContextDriver); ok {
+		return ctxDrv
+	}
+
+	return legacyDriver{drv}
+}
+
+// legacyDriver adapts a Driver which does not implement ContextDriver
+type legacyDriver struct {
+	Driver
+}
+
+func (drv legacyDriver) DatabaseExistsContext(context.Context) (bool, error) {
+	return drv.DatabaseExists()
+}
+
+func (drv legacyDriver) CreateDatabaseContext(context.Context) error {
+	return drv.CreateDatabase()
+}
+
+func (drv legacyDriver) DropDatabaseContext(context.Context) error {
+	return drv.DropDatabase()
+}
+
+func (drv legacyDriver) DumpSchemaContext(_ context.Context, db *sql.DB) ([]byte, error) {
+	return drv.DumpSchema(db)
+}
+
+func (drv legacyDriver) MigrationsTableExistsContext(_ context.Context, db *sql.DB) (bool, error) {
+	return drv.MigrationsTableExists(db)
+}
+
+func (drv legacyDriver) CreateMigrationsTableContext(_ context.Context, db *sql.DB) error {
+	return drv.CreateMigrationsTable(db)
+}
+
+func (drv legacyDriver) SelectMigrationsContext(_ context.Context, db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.SelectMigrations(db, limit)
+}
+
+func (drv legacyDriver) InsertMigrationContext(_ context.Context, db dbutil.Transaction, version string) error {
+	return drv.InsertMigration(db, version)
+}
+
+func (drv legacyDriver) DeleteMigrationContext(_ context.Context, db dbutil.Transaction, version string) error {
+	return drv.DeleteMigration(db, version)
+}
+
+func (drv legacyDriver) PingContext(context.Context) error {
+	return drv.Ping()
+}
+
+// TimeoutDriver is implemented by drivers which support statement and lock timeouts.
+// Timeouts are ignored for drivers which do not implement it.
+type TimeoutDriver interface {
+	// SetTimeouts applies statement and lock timeouts to a session, where 0 restores
+	// the server default
+	SetTimeouts(context.Context, dbutil.Transaction, time.Duration, time.Duration) error
+}
+
 // DriverConfig holds configuration passed to driver constructors
 type DriverConfig struct {
 	DatabaseURL         *url.URL
 	Log                 io.Writer
+	Logger              *slog.Logger
 	MigrationsTableName string
 }
 
+// GetLogger returns Logger, or if it is not set, a logger which writes human readable
+// messages to Log (or stdout if Log is not set either)
+func (config DriverConfig) GetLogger() *slog.Logger {
+	if config.Logger != nil {
+		return config.Logger
+	}
+	if config.Log == nil {
+		return slog.New(NewTextHandler(os.Stdout))
+	}
+
+	return slog.New(NewTextHandler(config.Log))
+}
+
 // DriverFunc represents a driver constructor
 type DriverFunc func(DriverConfig) Driver
 
@@ -68,6 +164,10 @@ func (e *QueryError) Error() string {
 	return e.Err.Error()
 }
 
+func (e *QueryError) Unwrap() error {
+	return e.Err
+}
+
 var drivers = map[string]DriverFunc{}
 
 // RegisterDriver registers a driver constructor for a given URL scheme
@@ -0,0 +1,150 @@
+package dbmate
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Writer creates files on behalf of dbmate, such as the schema file, new migrations,
+// and renumbered migrations. Paths use the same format as reads, so slash-separated
+// paths are passed when FS is set.
+type Writer interface {
+	// MkdirAll creates a directory and any missing parents
+	MkdirAll(dir string) error
+	// WriteFile creates or replaces a file
+	WriteFile(name string, data []byte) error
+	// Rename moves a file
+	Rename(oldpath, newpath string) error
+}
+
+// OSWriter writes to the OS filesystem
+type OSWriter struct{}
+
+// MkdirAll creates a directory and any missing parents
+func (OSWriter) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0o755)
+}
+
+// WriteFile creates or replaces a file
+func (OSWriter) WriteFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0o644)
+}
+
+// Rename moves a file
+func (OSWriter) Rename(oldpath, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+// DiscardWriter accepts and discards all writes, for read-only setups such as
+// migrations embedded in a binary, where the schema file is not needed
+type DiscardWriter struct{}
+
+// MkdirAll does nothing
+func (DiscardWriter) MkdirAll(string) error { return nil }
+
+// WriteFile does nothing
+func (DiscardWriter) WriteFile(string, []byte) error { return nil }
+
+// Rename does nothing
+func (DiscardWriter) Rename(string, string) error { return nil }
+
+// writer returns the Writer for files, which defaults to the OS filesystem
+func (db *DB) writer() Writer {
+	if db.Writer != nil {
+		return db.Writer
+	}
+
+	return OSWriter{}
+}
+
+// writeFile writes a file using the Writer, creating its directory if needed
+func (db *DB) writeFile(name string, data []byte) error {
+	w := db.writer()
+
+	if err := db.ensureDir(w, db.dirPath(name)); err != nil {
+		return err
+	}
+
+	return w.WriteFile(name, data)
+}
+
+// ensureDir creates a directory if it does not already exist
+func (db *DB) ensureDir(w Writer, dir string) error {
+	if err := w.MkdirAll(dir); err != nil {
+		return fmt.Errorf("%w `%s`", ErrCreateDirectory, dir)
+	}
+
+	return nil
+}
+
+// readFile reads a file from FS, or the OS filesystem if FS is nil
+func (db *DB) readFile(name string) ([]byte, error) {
+	if db.FS == nil {
+		return os.ReadFile(name)
+	}
+
+	return fs.ReadFile(db.FS, db.fsPath(name))
+}
+
+// readDir lists a directory in FS, or the OS filesystem if FS is nil
+func (db *DB) readDir(name string) ([]fs.DirEntry, error) {
+	if db.FS == nil {
+		return os.ReadDir(name)
+	}
+
+	return fs.ReadDir(db.FS, db.fsPath(name))
+}
+
+// stat returns information about a file in FS, or the OS filesystem if FS is nil
+func (db *DB) stat(name string) (fs.FileInfo, error) {
+	if db.FS == nil {
+		return os.Stat(name)
+	}
+
+	return fs.Stat(db.FS, db.fsPath(name))
+}
+
+// fsPath converts a path to the unrooted, slash-separated form required by io/fs,
+// e.g. ./db/migrations becomes db/migrations
+func (db *DB) fsPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// joinPath joins path elements using slashes if FS is set, or the OS separator otherwise
+func (db *DB) joinPath(elem ...string) string {
+	if db.FS == nil {
+		return filepath.Join(elem...)
+	}
+
+	return path.Join(elem...)
+}
+
+// fromSlash converts a slash-separated io/fs path to the OS format if FS is nil
+func (db *DB) fromSlash(name string) string {
+	if db.FS == nil {
+		return filepath.FromSlash(name)
+	}
+
+	return name
+}
+
+// dirPath returns the directory of a path, using slashes if FS is set
+func (db *DB) dirPath(name string) string {
+	if db.FS == nil {
+		return filepath.Dir(name)
+	}
+
+	return path.Dir(name)
+}
+
+// basePath returns the last element of a path, using slashes if FS is set
+func (db *DB) basePath(name string) string {
+	if db.FS == nil {
+		return filepath.Base(name)
+	}
+
+	return path.Base(name)
+}
@@ -0,0 +1,79 @@
+package dbmate
+
+import (
+	"io"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mapFSWriter writes to a fstest.MapFS, so that written files can be read back through FS
+type mapFSWriter struct {
+	fs fstest.MapFS
+}
+
+func (w mapFSWriter) MkdirAll(string) error { return nil }
+
+func (w mapFSWriter) WriteFile(name string, data []byte) error {
+	w.fs[name] = &fstest.MapFile{Data: data}
+	return nil
+}
+
+func (w mapFSWriter) Rename(oldpath, newpath string) error {
+	w.fs[newpath] = w.fs[oldpath]
+	delete(w.fs, oldpath)
+	return nil
+}
+
+func TestDiscardWriter(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"db/migrations/0001_create_users.sql": {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+	}
+	db := New(nil)
+	db.Log = io.Discard
+	db.FS = mapFS
+
+	// files are written to the OS filesystem by default, even when FS is set
+	require.Equal(t, OSWriter{}, db.writer())
+
+	// discarded writes succeed, without writing any files
+	db.Writer = DiscardWriter{}
+	require.NoError(t, db.NewMigration("create_posts"))
+	require.NoError(t, db.Renumber("db/migrations/0001_create_users.sql"))
+	require.Len(t, mapFS, 1)
+}
+
+func TestWriterFS(t *testing.T) {
+	mapFS := fstest.MapFS{
+		"db/migrations/0001_create_users.sql": {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+		"db/migrations/0001_create_posts.sql": {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+		"db/templates/default.sql":            {Data: []byte("-- {{.Name}}\n-- migrate:up\n-- migrate:down\n")},
+	}
+
+	db := New(nil)
+	db.Log = io.Discard
+	db.FS = mapFS
+	db.Writer = mapFSWriter{mapFS}
+	db.VersionStrategy = VersionSequential
+	db.VersionCollision = CollisionFirst
+
+	// paths use io/fs semantics, and templates are read from FS
+	require.NoError(t, db.NewMigration("create_comments"))
+	require.Equal(t, "-- create_comments\n-- migrate:up\n-- migrate:down\n", string(mapFS["db/migrations/0002_create_comments.sql"].Data))
+
+	// renamed files can be read back
+	require.NoError(t, db.Renumber())
+	migrations, err := db.migrationFiles()
+	require.NoError(t, err)
+
+	paths := []string{}
+	for _, migration := range migrations {
+		paths = append(paths, migration.FilePath)
+	}
+	require.Equal(t, []string{
+		"db/migrations/0001_create_posts.sql",
+		"db/migrations/0002_create_comments.sql",
+		"db/migrations/0003_create_users.sql",
+	}, paths)
+}
@@ -0,0 +1,160 @@
+package dbmate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+)
+
+// Hook identifies a point in the migration lifecycle
+type Hook string
+
+// Hook points
+const (
+	HookBeforeMigrate  Hook = "before-migrate"
+	HookAfterEach      Hook = "after-each"
+	HookAfterMigrate   Hook = "after-migrate"
+	HookOnError        Hook = "on-error"
+	HookBeforeRollback Hook = "before-rollback"
+	HookAfterRollback  Hook = "after-rollback"
+)
+
+// HookPoints lists all supported hook points
+var HookPoints = []Hook{
+	HookBeforeMigrate,
+	HookAfterEach,
+	HookAfterMigrate,
+	HookOnError,
+	HookBeforeRollback,
+	HookAfterRollback,
+}
+
+// ErrUnsupportedHook is returned when registering an unknown hook point
+var ErrUnsupportedHook = errors.New("unsupported hook")
+
+// HookEvent describes the lifecycle event which triggered a hook
+type HookEvent struct {
+	// Hook is the hook point being run
+	Hook Hook
+	// DB is the database connection used to run migrations
+	DB dbutil.Transaction
+	// Migration is the migration being applied or rolled back, or nil for
+	// before-migrate and after-migrate hooks
+	Migration *Migration
+	// Err is the error which caused an on-error hook to run
+	Err error
+}
+
+// HookFunc is a callback run at a hook point. Returning an error aborts the
+// current action, except for on-error hooks where the error is reported
+// alongside the original error.
+type HookFunc func(context.Context, HookEvent) error
+
+// ParseHook validates a hook point name
+func ParseHook(name string) (Hook, error) {
+	for _, hook := range HookPoints {
+		if string(hook) == name {
+			return hook, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedHook, name)
+}
+
+// AddHook registers a callback to run at the specified hook point.
+// Callbacks for the same hook point run in the order they were added.
+func (db *DB) AddHook(hook Hook, f HookFunc) {
+	if db.Hooks == nil {
+		db.Hooks = map[Hook][]HookFunc{}
+	}
+
+	db.Hooks[hook] = append(db.Hooks[hook], f)
+}
+
+// AddSQLHook registers a SQL file to execute on the migration connection at the
+// specified hook point. The file is read from db.FS (if set) each time the hook runs.
+func (db *DB) AddSQLHook(hook Hook, path string) {
+	db.AddHook(hook, func(ctx context.Context, event HookEvent) error {
+		contents, err := db.readFile(path)
+		if err != nil {
+			return err
+		}
+
+		db.logHook(event.Hook, path)
+		if _, err := dbutil.ExecContext(ctx, event.DB, string(contents)); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		return nil
+	})
+}
+
+// AddCommandHook registers a shell command to run at the specified hook point.
+// Details of the event are passed to the command in DBMATE_* environment variables.
+func (db *DB) AddCommandHook(hook Hook, command string) {
+	db.AddHook(hook, func(ctx context.Context, event HookEvent) error {
+		cmd := shellCommand(ctx, command)
+		cmd.Stdout = db.Log
+		cmd.Stderr = os.Stderr
+		cmd.Env = append(os.Environ(), "DBMATE_HOOK="+string(event.Hook))
+		if event.Migration != nil {
+			cmd.Env = append(cmd.Env,
+				"DBMATE_MIGRATION_VERSION="+event.Migration.Version,
+				"DBMATE_MIGRATION_FILE="+event.Migration.FilePath,
+			)
+		}
+		if event.Err != nil {
+			cmd.Env = append(cmd.Env, "DBMATE_ERROR="+event.Err.Error())
+		}
+
+		db.logHook(event.Hook, command)
+		return cmd.Run()
+	})
+}
+
+// shellCommand returns a command which runs a shell command line
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+
+	return exec.CommandContext(ctx, shell, flag, command)
+}
+
+// runHooks runs all callbacks registered for a hook point, stopping at the first error
+func (db *DB) runHooks(ctx context.Context, hook Hook, event HookEvent) error {
+	event.Hook = hook
+	for _, f := range db.Hooks[hook] {
+		if err := f(ctx, event); err != nil {
+			return fmt.Errorf("%s hook failed: %w", hook, err)
+		}
+	}
+
+	return nil
+}
+
+// runErrorHooks runs the on-error hooks for a failed migration, and returns the
+// original error joined with any hook error
+func (db *DB) runErrorHooks(ctx context.Context, sqlDB dbutil.Transaction, migration *Migration, err error) error {
+	hookErr := db.runHooks(ctx, HookOnError, HookEvent{
+		DB:        sqlDB,
+		Migration: migration,
+		Err:       err,
+	})
+	if hookErr != nil {
+		return errors.Join(err, hookErr)
+	}
+
+	return err
+}
+
+// logHook logs a hook about to run
+func (db *DB) logHook(hook Hook, target string) {
+	db.logger().Info(fmt.Sprintf("Running %s hook: %s", hook, target), EventKey, EventHook, "hook", string(hook), "target", target)
+}
@@ -0,0 +1,611 @@
+package dbmate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+)
+
+// ImportSource specifies the migration tool to import from
+type ImportSource string
+
+// Import sources
+const (
+	// ImportGoose imports VERSION_name.sql files with -- +goose annotations, and the goose_db_version table
+	ImportGoose ImportSource = "goose"
+	// ImportGolangMigrate imports VERSION_name.up.sql and .down.sql files, and the schema_migrations table
+	ImportGolangMigrate ImportSource = "golang-migrate"
+	// ImportFlyway imports VVERSION__name.sql and UVERSION__name.sql files, and the flyway_schema_history table
+	ImportFlyway ImportSource = "flyway"
+)
+
+// Import errors
+var (
+	ErrUnsupportedImportSource = errors.New("unsupported import source")
+	ErrImportDirty             = errors.New("migration history is dirty")
+)
+
+// ParseImportSource validates an import source name
+func ParseImportSource(name string) (ImportSource, error) {
+	switch source := ImportSource(name); source {
+	case ImportGoose, ImportGolangMigrate, ImportFlyway:
+		return source, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedImportSource, name)
+}
+
+// historyTable returns the default name of the history table used by the tool
+func (s ImportSource) historyTable() string {
+	switch s {
+	case ImportGoose:
+		return "goose_db_version"
+	case ImportGolangMigrate:
+		return "schema_migrations"
+	case ImportFlyway:
+		return "flyway_schema_history"
+	}
+
+	return ""
+}
+
+// ImportOptions specifies what to import from another migration tool
+type ImportOptions struct {
+	// From is the tool which created the migrations
+	From ImportSource
+	// Dir is the directory containing the migration files of the other tool
+	Dir string
+	// HistoryTable is the table the other tool records applied migrations in, or empty for its default
+	HistoryTable string
+	// SkipFiles does not write converted migration files
+	SkipFiles bool
+	// SkipHistory does not connect to the database to copy applied migrations into the migrations table
+	SkipHistory bool
+}
+
+// importedMigration is a migration converted from another tool
+type importedMigration struct {
+	// Source lists the files the migration was converted from
+	Source []string
+	// SourceVersion is the version recorded in the history table of the other tool
+	SourceVersion string
+	// Version is the dbmate version
+	Version  string
+	FileName string
+	Contents string
+}
+
+// importSet is the result of reading the migration files of another tool
+type importSet struct {
+	migrations []importedMigration
+	// version converts a version from the history table of the other tool
+	version func(string) string
+}
+
+var (
+	tableNameRegExp        = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*$`)
+	gooseFileRegExp        = regexp.MustCompile(`^(\d+)_.*\.(sql|go)$`)
+	gooseAnnotationRegExp  = regexp.MustCompile(`(?i)^--\s*\+goose\s+(up|down|statementbegin|statementend|no transaction)\b`)
+	golangMigrateRegExp    = regexp.MustCompile(`^(\d+)_(.*)\.(up|down)\.sql$`)
+	flywayFileRegExp       = regexp.MustCompile(`^([VUR])([0-9._]*)__(.*)\.sql$`)
+	flywayVersionSeparator = regexp.MustCompile(`[._]`)
+)
+
+// Import converts the migration files of another tool into dbmate migrations in the
+// first MigrationsDir, and records the migrations which the other tool has applied
+// in the migrations table
+func (db *DB) Import(opts ImportOptions) error {
+	return db.ImportContext(context.Background(), opts)
+}
+
+// ImportContext converts the migration files of another tool into dbmate migrations
+// in the first MigrationsDir, and records the migrations which the other tool has
+// applied in the migrations table
+func (db *DB) ImportContext(ctx context.Context, opts ImportOptions) error {
+	if _, err := ParseImportSource(string(opts.From)); err != nil {
+		return err
+	}
+
+	set, err := db.readImportFiles(opts.From, opts.Dir)
+	if err != nil {
+		return err
+	}
+
+	if !opts.SkipFiles {
+		if err := db.writeImportedMigrations(set.migrations); err != nil {
+			return err
+		}
+	}
+
+	if !opts.SkipHistory {
+		return db.importHistory(ctx, opts, set)
+	}
+
+	return nil
+}
+
+// readImportFiles converts the migration files in dir
+func (db *DB) readImportFiles(source ImportSource, dir string) (*importSet, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w `%s`", ErrMigrationDirNotFound, dir)
+	}
+
+	names := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+
+	switch source {
+	case ImportGoose:
+		return db.readGooseFiles(dir, names)
+	case ImportGolangMigrate:
+		return readGolangMigrateFiles(dir, names)
+	case ImportFlyway:
+		return db.readFlywayFiles(dir, names)
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedImportSource, source)
+}
+
+// readGooseFiles converts goose SQL migrations, replacing -- +goose annotations
+// with dbmate directives. Go migrations cannot be converted, and are skipped.
+func (db *DB) readGooseFiles(dir string, names []string) (*importSet, error) {
+	migrations := []importedMigration{}
+	for _, name := range names {
+		matches := gooseFileRegExp.FindStringSubmatch(name)
+		if matches == nil {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if matches[2] == "go" {
+			db.logger().Warn("Skipping Go migration: "+path, EventKey, EventMigrationSkip, "file", path)
+			continue
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, importedMigration{
+			Source:        []string{path},
+			SourceVersion: matches[1],
+			Version:       matches[1],
+			FileName:      name,
+			Contents:      convertGooseMigration(string(contents)),
+		})
+	}
+
+	return &importSet{migrations: migrations, version: numericVersionMap(migrations)}, nil
+}
+
+// convertGooseMigration replaces goose annotations with dbmate directives
+func convertGooseMigration(contents string) string {
+	converted := []string{}
+	directives := []int{}
+	options := ""
+	hasDown := false
+	for _, line := range strings.SplitAfter(contents, "\n") {
+		matches := gooseAnnotationRegExp.FindStringSubmatch(strings.TrimSpace(line))
+		if matches == nil {
+			converted = append(converted, line)
+			continue
+		}
+
+		// statement boundaries are not needed, since dbmate does not split statements
+		switch strings.ToLower(matches[1]) {
+		case "up":
+			directives = append(directives, len(converted))
+			converted = append(converted, "-- migrate:up")
+		case "down":
+			directives = append(directives, len(converted))
+			converted = append(converted, "-- migrate:down")
+			hasDown = true
+		case "no transaction":
+			options = " transaction:false"
+		}
+	}
+
+	if !hasDown {
+		if last := len(converted) - 1; last >= 0 && !strings.HasSuffix(converted[last], "\n") {
+			converted[last] += "\n"
+		}
+		converted = append(converted, "\n")
+		directives = append(directives, len(converted))
+		converted = append(converted, "-- migrate:down")
+	}
+	for _, i := range directives {
+		converted[i] += options + "\n"
+	}
+
+	return strings.Join(converted, "")
+}
+
+// readGolangMigrateFiles combines each pair of golang-migrate .up.sql and .down.sql files
+func readGolangMigrateFiles(dir string, names []string) (*importSet, error) {
+	type pair struct {
+		version, title string
+		up, down       string
+		source         []string
+	}
+	pairs := map[string]*pair{}
+
+	for _, name := range names {
+		matches := golangMigrateRegExp.FindStringSubmatch(name)
+		if matches == nil {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		p := pairs[matches[1]]
+		if p == nil {
+			p = &pair{version: matches[1], title: matches[2]}
+			pairs[matches[1]] = p
+		}
+		p.source = append(p.source, path)
+		if matches[3] == "up" {
+			p.up = string(contents)
+		} else {
+			p.down = string(contents)
+		}
+	}
+
+	migrations := []importedMigration{}
+	for _, version := range sortedKeys(pairs) {
+		p := pairs[version]
+		contents, _, err := combineSplitMigration(p.up, p.down, true, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.Join(p.source, ", "), err)
+		}
+
+		migrations = append(migrations, importedMigration{
+			Source:        p.source,
+			SourceVersion: p.version,
+			Version:       p.version,
+			FileName:      fmt.Sprintf("%s_%s.sql", p.version, p.title),
+			Contents:      contents,
+		})
+	}
+
+	return &importSet{migrations: migrations, version: numericVersionMap(migrations)}, nil
+}
+
+// readFlywayFiles combines each versioned migration with its undo migration (if any).
+// Flyway versions such as 1.2 are converted to numbers, padding each part to the same
+// width so that versions sort correctly, e.g. 1.2 becomes 001002 if the highest part is 100.
+// Repeatable migrations have no version, and are skipped.
+func (db *DB) readFlywayFiles(dir string, names []string) (*importSet, error) {
+	type pair struct {
+		version, title string
+		up, down       string
+		hasUp          bool
+		source         []string
+	}
+	pairs := map[string]*pair{}
+	parts, width := 1, 1
+
+	for _, name := range names {
+		matches := flywayFileRegExp.FindStringSubmatch(name)
+		if matches == nil {
+			continue
+		}
+
+		path := filepath.Join(dir, name)
+		if matches[1] == "R" {
+			db.logger().Warn("Skipping repeatable migration: "+path, EventKey, EventMigrationSkip, "file", path)
+			continue
+		}
+
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		version := matches[2]
+		versionParts := flywayVersionSeparator.Split(version, -1)
+		parts = max(parts, len(versionParts))
+		for _, part := range versionParts {
+			width = max(width, len(part))
+		}
+
+		p := pairs[version]
+		if p == nil {
+			p = &pair{version: version}
+			pairs[version] = p
+		}
+		p.source = append(p.source, path)
+		if matches[1] == "V" {
+			p.up, p.hasUp, p.title = string(contents), true, matches[3]
+		} else {
+			p.down = string(contents)
+			if p.title == "" {
+				p.title = matches[3]
+			}
+		}
+	}
+
+	convert := func(version string) string {
+		versionParts := flywayVersionSeparator.Split(version, -1)
+		result := ""
+		for i := 0; i < max(parts, len(versionParts)); i++ {
+			part := "0"
+			if i < len(versionParts) && versionParts[i] != "" {
+				part = strings.TrimLeft(versionParts[i], "0")
+			}
+			result += strings.Repeat("0", width-len(part)) + part
+		}
+		return result
+	}
+
+	migrations := []importedMigration{}
+	for _, key := range sortedKeys(pairs) {
+		p := pairs[key]
+		if !p.hasUp {
+			return nil, fmt.Errorf("%s: %w", strings.Join(p.source, ", "), ErrParseMissingUp)
+		}
+		contents, _, err := combineSplitMigration(p.up, p.down, true, true)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", strings.Join(p.source, ", "), err)
+		}
+
+		version := convert(p.version)
+		migrations = append(migrations, importedMigration{
+			Source:        p.source,
+			SourceVersion: p.version,
+			Version:       version,
+			FileName:      fmt.Sprintf("%s_%s.sql", version, strings.ToLower(p.title)),
+			Contents:      contents,
+		})
+	}
+
+	sort.SliceStable(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return &importSet{migrations: migrations, version: convert}, nil
+}
+
+// numericVersionMap returns a function which converts a numeric version from a
+// history table to the version of the matching migration file, ignoring leading zeros
+func numericVersionMap(migrations []importedMigration) func(string) string {
+	versions := map[string]string{}
+	for _, migration := range migrations {
+		versions[trimVersion(migration.Version)] = migration.Version
+	}
+
+	return func(version string) string {
+		if v, ok := versions[trimVersion(version)]; ok {
+			return v
+		}
+		return version
+	}
+}
+
+// trimVersion removes leading zeros from a numeric version
+func trimVersion(version string) string {
+	trimmed := strings.TrimLeft(version, "0")
+	if trimmed == "" {
+		return "0"
+	}
+	return trimmed
+}
+
+// writeImportedMigrations writes converted migrations to the first MigrationsDir.
+// Existing files with identical contents are left in place, so that an import
+// can be repeated for each environment.
+func (db *DB) writeImportedMigrations(migrations []importedMigration) error {
+	if len(migrations) == 0 {
+		return ErrNoMigrationFiles
+	}
+
+	w := db.writer()
+	if err := db.ensureDir(w, db.MigrationsDir[0]); err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		path := db.joinPath(db.MigrationsDir[0], migration.FileName)
+		existing, err := db.readFile(path)
+		if err == nil {
+			if string(existing) == migration.Contents {
+				continue
+			}
+			return fmt.Errorf("%w: %s", ErrMigrationAlreadyExist, path)
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+
+		db.logger().Info(fmt.Sprintf("Importing: %s -> %s", strings.Join(migration.Source, ", "), path),
+			EventKey, EventMigrationImport, "version", migration.Version, "file", path)
+		if err := w.WriteFile(path, []byte(migration.Contents)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// importHistory reads the versions applied by another tool, and records them in the migrations table
+func (db *DB) importHistory(ctx context.Context, opts ImportOptions, set *importSet) error {
+	table := opts.HistoryTable
+	if table == "" {
+		table = opts.From.historyTable()
+	}
+	if !tableNameRegExp.MatchString(table) {
+		return fmt.Errorf("invalid history table name `%s`", table)
+	}
+	if table == db.MigrationsTableName {
+		return fmt.Errorf("the %s history table `%s` is also the dbmate migrations table, use a different migrations table", opts.From, table)
+	}
+
+	drv, err := db.DriverContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.openDatabaseForMigration(ctx, drv)
+	if err != nil {
+		return err
+	}
+	defer dbutil.MustClose(sqlDB)
+
+	var versions []string
+	switch opts.From {
+	case ImportGoose:
+		versions, err = selectGooseHistory(ctx, sqlDB, table)
+	case ImportGolangMigrate:
+		versions, err = selectGolangMigrateHistory(ctx, sqlDB, table, set.migrations)
+	case ImportFlyway:
+		versions, err = selectFlywayHistory(ctx, sqlDB, table, set)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read %s history table `%s`: %w", opts.From, table, err)
+	}
+
+	applied, err := contextDriver(drv).SelectMigrationsContext(ctx, sqlDB, -1)
+	if err != nil {
+		return err
+	}
+
+	for _, version := range versions {
+		version = set.version(version)
+		if applied[version] {
+			continue
+		}
+
+		db.logger().Info("Recording: "+version, EventKey, EventHistoryImport, "version", version)
+		err := doTransaction(ctx, sqlDB, func(tx dbutil.Transaction) error {
+			return contextDriver(drv).InsertMigrationContext(ctx, tx, version)
+		})
+		if err != nil {
+			return err
+		}
+		applied[version] = true
+	}
+
+	return nil
+}
+
+// selectGooseHistory returns the versions goose has applied. Each row of the history
+// table records a version being applied or rolled back, so the last row for each
+// version determines its state. Version 0 is created by goose itself, and is ignored.
+func selectGooseHistory(ctx context.Context, sqlDB *sql.DB, table string) ([]string, error) {
+	rows, err := sqlDB.QueryContext(ctx, "select version_id, is_applied from "+table+" order by id")
+	if err != nil {
+		return nil, err
+	}
+	defer dbutil.MustClose(rows)
+
+	state := map[string]bool{}
+	for rows.Next() {
+		var version string
+		var isApplied bool
+		if err := rows.Scan(&version, &isApplied); err != nil {
+			return nil, err
+		}
+		if trimVersion(version) != "0" {
+			state[version] = isApplied
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, version := range sortedKeys(state) {
+		if state[version] {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, nil
+}
+
+// selectGolangMigrateHistory returns the versions golang-migrate has applied. The history
+// table only records the current version, so every migration up to that version is applied.
+func selectGolangMigrateHistory(ctx context.Context, sqlDB *sql.DB, table string, migrations []importedMigration) ([]string, error) {
+	var current string
+	var dirty bool
+	err := sqlDB.QueryRowContext(ctx, "select version, dirty from "+table).Scan(&current, &dirty)
+	if errors.Is(err, sql.ErrNoRows) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if dirty {
+		return nil, fmt.Errorf("%w at version %s, fix the failed migration before importing", ErrImportDirty, current)
+	}
+
+	versions := []string{}
+	for _, migration := range migrations {
+		if compareVersions(migration.SourceVersion, current) <= 0 {
+			versions = append(versions, migration.SourceVersion)
+		}
+	}
+
+	return versions, nil
+}
+
+// selectFlywayHistory returns the versions flyway has applied, excluding failed and
+// undone migrations. Migrations up to a baseline version are treated as applied.
+func selectFlywayHistory(ctx context.Context, sqlDB *sql.DB, table string, set *importSet) ([]string, error) {
+	rows, err := sqlDB.QueryContext(ctx, "select version, type from "+table+
+		" where success = true and version is not null order by installed_rank")
+	if err != nil {
+		return nil, err
+	}
+	defer dbutil.MustClose(rows)
+
+	state := map[string]bool{}
+	for rows.Next() {
+		var version, kind string
+		if err := rows.Scan(&version, &kind); err != nil {
+			return nil, err
+		}
+
+		switch kind {
+		case "UNDO_SQL", "UNDO_JDBC", "UNDO_SCRIPT":
+			state[version] = false
+		case "BASELINE":
+			state[version] = true
+			baseline := set.version(version)
+			for _, migration := range set.migrations {
+				if migration.Version <= baseline {
+					state[migration.SourceVersion] = true
+				}
+			}
+		default:
+			state[version] = true
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	versions := []string{}
+	for _, version := range sortedKeys(state) {
+		if state[version] {
+			versions = append(versions, version)
+		}
+	}
+
+	return versions, nil
+}
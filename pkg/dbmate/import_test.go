@@ -0,0 +1,143 @@
+package dbmate
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImportSource(t *testing.T) {
+	source, err := ParseImportSource("golang-migrate")
+	require.NoError(t, err)
+	require.Equal(t, ImportGolangMigrate, source)
+
+	_, err = ParseImportSource("rails")
+	require.ErrorIs(t, err, ErrUnsupportedImportSource)
+}
+
+func TestConvertGooseMigration(t *testing.T) {
+	t.Run("annotations", func(t *testing.T) {
+		contents := `-- +goose Up
+-- +goose StatementBegin
+create function noop() returns void as $$ begin end; $$ language plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+drop function noop();
+`
+		require.Equal(t, `-- migrate:up
+create function noop() returns void as $$ begin end; $$ language plpgsql;
+
+-- migrate:down
+drop function noop();
+`, convertGooseMigration(contents))
+	})
+
+	t.Run("no transaction", func(t *testing.T) {
+		contents := "-- +goose NO TRANSACTION\n-- +goose Up\ncreate index concurrently users_idx on users (name);"
+		converted := convertGooseMigration(contents)
+		require.Equal(t, "-- migrate:up transaction:false\ncreate index concurrently users_idx on users (name);\n\n-- migrate:down transaction:false\n", converted)
+
+		parsed, err := parseMigrationContents(converted)
+		require.NoError(t, err)
+		require.False(t, parsed.UpOptions.Transaction())
+		require.False(t, parsed.DownOptions.Transaction())
+	})
+}
+
+func TestImportFiles(t *testing.T) {
+	writeFiles := func(t *testing.T, dir string, files map[string]string) {
+		require.NoError(t, os.MkdirAll(dir, 0o755))
+		for name, contents := range files {
+			require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(contents), 0o644))
+		}
+	}
+	readFiles := func(t *testing.T, dir string) map[string]string {
+		files := map[string]string{}
+		for _, name := range listMigrationFiles(t, dir) {
+			contents, err := os.ReadFile(filepath.Join(dir, name))
+			require.NoError(t, err)
+			files[name] = string(contents)
+		}
+		return files
+	}
+
+	for _, tc := range []struct {
+		from     ImportSource
+		files    map[string]string
+		expected map[string]string
+	}{
+		{
+			from: ImportGoose,
+			files: map[string]string{
+				"00001_create_users.sql": "-- +goose Up\ncreate table users (id int);\n-- +goose Down\ndrop table users;\n",
+				"00002_backfill.go":      "package migrations\n",
+				"README.md":              "# migrations\n",
+			},
+			expected: map[string]string{
+				"00001_create_users.sql": "-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n",
+			},
+		},
+		{
+			from: ImportGolangMigrate,
+			files: map[string]string{
+				"000001_create_users.up.sql":   "create table users (id int);\n",
+				"000001_create_users.down.sql": "drop table users;\n",
+				"000002_create_posts.up.sql":   "create table posts (id int);",
+			},
+			expected: map[string]string{
+				"000001_create_users.sql": "-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n",
+				"000002_create_posts.sql": "-- migrate:up\ncreate table posts (id int);\n-- migrate:down\n",
+			},
+		},
+		{
+			from: ImportFlyway,
+			files: map[string]string{
+				"V1__Create_users.sql":   "create table users (id int);\n",
+				"U1__Create_users.sql":   "drop table users;\n",
+				"V1.2__Add_email.sql":    "alter table users add email text;\n",
+				"V1_10__Add_name.sql":    "alter table users add name text;\n",
+				"V2__Create_posts.sql":   "create table posts (id int);\n",
+				"R__Refresh_views.sql":   "create or replace view user_names as select name from users;\n",
+				"flyway.conf.sql.backup": "",
+			},
+			expected: map[string]string{
+				"0100_create_users.sql": "-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n",
+				"0102_add_email.sql":    "-- migrate:up\nalter table users add email text;\n-- migrate:down\n",
+				"0110_add_name.sql":     "-- migrate:up\nalter table users add name text;\n-- migrate:down\n",
+				"0200_create_posts.sql": "-- migrate:up\ncreate table posts (id int);\n-- migrate:down\n",
+			},
+		},
+	} {
+		t.Run(string(tc.from), func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, filepath.Join(dir, "source"), tc.files)
+
+			db := New(nil)
+			db.Log = io.Discard
+			db.MigrationsDir = []string{filepath.Join(dir, "migrations")}
+
+			opts := ImportOptions{From: tc.from, Dir: filepath.Join(dir, "source"), SkipHistory: true}
+			require.NoError(t, db.Import(opts))
+			require.Equal(t, tc.expected, readFiles(t, db.MigrationsDir[0]))
+
+			// converted migrations are valid
+			problems, err := db.Validate()
+			require.NoError(t, err)
+			require.Empty(t, problems)
+
+			// importing again leaves identical files in place
+			require.NoError(t, db.Import(opts))
+
+			// but does not overwrite changes
+			for name := range tc.expected {
+				require.NoError(t, os.WriteFile(filepath.Join(db.MigrationsDir[0], name), []byte("-- changed\n"), 0o644))
+				break
+			}
+			require.ErrorIs(t, db.Import(opts), ErrMigrationAlreadyExist)
+		})
+	}
+}
@@ -0,0 +1,384 @@
+package dbmate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// LintRule identifies a check performed by the migration linter
+type LintRule string
+
+// Lint rules
+const (
+	LintCreateIndexConcurrently   LintRule = "create-index-concurrently"
+	LintConcurrentlyInTransaction LintRule = "concurrently-in-transaction"
+	LintAddColumnNotNull          LintRule = "add-column-not-null"
+	LintDropColumn                LintRule = "drop-column"
+	LintDropTable                 LintRule = "drop-table"
+	LintMissingDown               LintRule = "missing-down"
+	LintTransactionFalse          LintRule = "transaction-false"
+	// LintInvalidMigration is reported for files which cannot be parsed, and cannot be disabled
+	LintInvalidMigration LintRule = "invalid-migration"
+)
+
+// LintRules lists all lint rules which can be disabled
+var LintRules = []LintRule{
+	LintCreateIndexConcurrently,
+	LintConcurrentlyInTransaction,
+	LintAddColumnNotNull,
+	LintDropColumn,
+	LintDropTable,
+	LintMissingDown,
+	LintTransactionFalse,
+}
+
+// ErrUnsupportedLintRule is returned when disabling an unknown lint rule
+var ErrUnsupportedLintRule = errors.New("unsupported lint rule")
+
+// ParseLintRule validates a lint rule name
+func ParseLintRule(name string) (LintRule, error) {
+	for _, rule := range LintRules {
+		if string(rule) == name {
+			return rule, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedLintRule, name)
+}
+
+// LintOptions configures the migration linter
+type LintOptions struct {
+	// All lints every migration file rather than only pending migrations,
+	// without connecting to the database
+	All bool
+	// Disabled lists rules which should not be checked
+	Disabled []LintRule
+}
+
+// LintIssue describes a risky pattern found in a migration file
+type LintIssue struct {
+	FilePath string
+	Line     int
+	Rule     LintRule
+	Message  string
+}
+
+func (i LintIssue) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", i.FilePath, i.Line, i.Rule, i.Message)
+}
+
+// Lint statically analyzes migration files for risky patterns
+func (db *DB) Lint(opts LintOptions) ([]LintIssue, error) {
+	return db.LintContext(context.Background(), opts)
+}
+
+// LintContext statically analyzes migration files for risky patterns
+func (db *DB) LintContext(ctx context.Context, opts LintOptions) ([]LintIssue, error) {
+	if db.DatabaseURL == nil || db.DatabaseURL.Scheme == "" {
+		return nil, ErrInvalidURL
+	}
+
+	var migrations []Migration
+	var err error
+	if opts.All {
+		migrations, err = db.migrationFiles()
+	} else {
+		migrations, err = db.FindMigrationsContext(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	disabled := map[LintRule]bool{}
+	for _, rule := range opts.Disabled {
+		disabled[rule] = true
+	}
+
+	issues := []LintIssue{}
+	for _, migration := range migrations {
+		if migration.Applied || migration.SkipReason != "" {
+			continue
+		}
+
+		contents, layout, err := migration.readContents()
+		if errors.Is(err, ErrParseSplitDirective) {
+			issues = append(issues, LintIssue{FilePath: migration.FilePath, Line: 1, Rule: LintInvalidMigration, Message: err.Error()})
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		migrationIssues := lintMigration(db.DatabaseURL.Scheme, migration.FilePath, contents, disabled)
+		if layout != nil {
+			// report lines of the individual up and down files
+			for i := range migrationIssues {
+				migrationIssues[i].FilePath, migrationIssues[i].Line = layout.sourceLine(&migration, migrationIssues[i].Line)
+			}
+		}
+		issues = append(issues, migrationIssues...)
+	}
+
+	return issues, nil
+}
+
+var (
+	lintIgnoreRegExp        = regexp.MustCompile(`dbmate:lint-ignore\b([\w\-, ]*)`)
+	createIndexRegExp       = regexp.MustCompile(`^create (?:unique )?index (concurrently )?(?:if not exists )?(?:[^ (]+ )?on (?:only )?([^ (]+)`)
+	concurrentlyRegExp      = regexp.MustCompile(`^(?:create (?:unique )?index|drop index|reindex .*|refresh materialized view) concurrently\b`)
+	createTableRegExp       = regexp.MustCompile(`^create (?:(?:global |local )?(?:temporary |temp )|unlogged )?table (?:if not exists )?([^ (]+)`)
+	alterTableRegExp        = regexp.MustCompile(`^alter table `)
+	addColumnNotNullRegExp  = regexp.MustCompile(`\badd (?:column )?(?:if not exists )?[^,]*\bnot null\b`)
+	addConstraintRegExp     = regexp.MustCompile(`\badd (?:constraint|primary key|unique|foreign key|check|index|key)\b`)
+	defaultRegExp           = regexp.MustCompile(`\bdefault\b`)
+	dropColumnRegExp        = regexp.MustCompile(`\bdrop column\b`)
+	dropTableRegExp         = regexp.MustCompile(`^drop table\b`)
+	dollarQuoteRegExp       = regexp.MustCompile(`^\$[A-Za-z_]*\$`)
+	nonTransactionalRegExps = map[string]*regexp.Regexp{
+		"postgres": regexp.MustCompile(`\bconcurrently\b|^vacuum\b|^alter type .* add value\b|^(?:create|drop) database\b|^alter system\b|^(?:create|drop) tablespace\b`),
+		"sqlite":   regexp.MustCompile(`^vacuum\b|^pragma\b`),
+	}
+)
+
+// lintDriver returns the canonical name of a driver scheme for lint rules
+func lintDriver(scheme string) string {
+	switch scheme {
+	case "postgres", "postgresql", "redshift", "spanner-postgres":
+		return "postgres"
+	case "sqlite", "sqlite3":
+		return "sqlite"
+	}
+
+	return scheme
+}
+
+// lintMigration checks the contents of a single migration file
+func lintMigration(scheme, path, contents string, disabled map[LintRule]bool) []LintIssue {
+	driver := lintDriver(scheme)
+	issues := []LintIssue{}
+	report := func(line int, rule LintRule, ignored map[LintRule]bool, message string) {
+		if disabled[rule] || ignored[rule] || ignored["all"] {
+			return
+		}
+		issues = append(issues, LintIssue{FilePath: path, Line: line, Rule: rule, Message: message})
+	}
+
+	parsed, err := parseMigrationContents(contents)
+	if err != nil {
+		issues = append(issues, LintIssue{FilePath: path, Line: 1, Rule: LintInvalidMigration, Message: err.Error()})
+		return issues
+	}
+
+	upLine := strings.Count(contents[:strings.Index(contents, parsed.Up)], "\n") + 1
+	downLine := strings.Count(contents[:strings.LastIndex(contents, parsed.Down)], "\n") + 1
+	upStatements, upIgnored := splitLintStatements(parsed.Up, upLine)
+	downStatements, downIgnored := splitLintStatements(parsed.Down, downLine)
+
+	// tables created in this migration are not yet in use, so locking them is harmless
+	createdTables := map[string]bool{}
+	for _, stmt := range upStatements {
+		if match := createTableRegExp.FindStringSubmatch(stmt.sql); match != nil {
+			createdTables[match[1]] = true
+		}
+	}
+
+	for _, stmt := range upStatements {
+		if driver == "postgres" {
+			if match := createIndexRegExp.FindStringSubmatch(stmt.sql); match != nil && match[1] == "" && !createdTables[match[2]] {
+				report(stmt.line, LintCreateIndexConcurrently, stmt.ignored,
+					"CREATE INDEX without CONCURRENTLY blocks writes to the table while the index is built")
+			}
+		}
+
+		if driver != "clickhouse" && alterTableRegExp.MatchString(stmt.sql) &&
+			addColumnNotNullRegExp.MatchString(stmt.sql) && !addConstraintRegExp.MatchString(stmt.sql) &&
+			!defaultRegExp.MatchString(stmt.sql) {
+			report(stmt.line, LintAddColumnNotNull, stmt.ignored,
+				"adding a NOT NULL column without a DEFAULT fails if the table contains rows")
+		}
+
+		if alterTableRegExp.MatchString(stmt.sql) && dropColumnRegExp.MatchString(stmt.sql) {
+			report(stmt.line, LintDropColumn, stmt.ignored,
+				"DROP COLUMN permanently deletes data, and breaks code still reading the column")
+		}
+
+		if dropTableRegExp.MatchString(stmt.sql) {
+			report(stmt.line, LintDropTable, stmt.ignored,
+				"DROP TABLE permanently deletes data, and breaks code still reading the table")
+		}
+	}
+
+	// rules which apply to both blocks
+	blocks := []struct {
+		statements []lintStatement
+		ignored    map[LintRule]bool
+		options    ParsedMigrationOptions
+		line       int
+	}{
+		{upStatements, upIgnored, parsed.UpOptions, upLine},
+		{downStatements, downIgnored, parsed.DownOptions, downLine},
+	}
+	for _, block := range blocks {
+		needsNoTransaction := false
+		for _, stmt := range block.statements {
+			if re := nonTransactionalRegExps[driver]; re != nil && re.MatchString(stmt.sql) {
+				needsNoTransaction = true
+			}
+
+			if driver == "postgres" && block.options.Transaction() && concurrentlyRegExp.MatchString(stmt.sql) {
+				report(stmt.line, LintConcurrentlyInTransaction, stmt.ignored,
+					"CONCURRENTLY cannot run inside a transaction, add transaction:false to the migrate directive")
+			}
+		}
+
+		if nonTransactionalRegExps[driver] != nil && !block.options.Transaction() && !needsNoTransaction && len(block.statements) > 0 {
+			report(block.line, LintTransactionFalse, block.ignored,
+				"transaction:false is only needed for statements which cannot run in a transaction, and a failure may leave the migration partially applied")
+		}
+	}
+
+	if len(downStatements) == 0 {
+		report(downLine, LintMissingDown, downIgnored,
+			"migration has an empty down block, and cannot be rolled back")
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		return issues[i].Line < issues[j].Line
+	})
+
+	return issues
+}
+
+// lintStatement is a single SQL statement within a migration block
+type lintStatement struct {
+	// sql is the lowercase statement text, with comments removed and whitespace collapsed
+	sql string
+	// line is the line number where the statement starts
+	line int
+	// ignored lists rules suppressed by dbmate:lint-ignore comments within the statement
+	ignored map[LintRule]bool
+}
+
+// splitLintStatements splits a migration block into statements, and also
+// returns the rules suppressed anywhere within the block
+func splitLintStatements(block string, firstLine int) ([]lintStatement, map[LintRule]bool) {
+	statements := []lintStatement{}
+	blockIgnored := map[LintRule]bool{}
+	current := lintStatement{ignored: map[LintRule]bool{}}
+	var sql strings.Builder
+	line := firstLine
+	lastEndLine := -1
+
+	addIgnored := func(comment string) {
+		match := lintIgnoreRegExp.FindStringSubmatch(comment)
+		if match == nil {
+			return
+		}
+
+		// a comment on the same line as the end of the previous statement applies to that statement
+		target := current.ignored
+		if sql.Len() == 0 && line == lastEndLine && len(statements) > 0 {
+			target = statements[len(statements)-1].ignored
+		}
+
+		rules := strings.FieldsFunc(match[1], func(r rune) bool { return r == ',' || r == ' ' })
+		if len(rules) == 0 {
+			rules = []string{"all"}
+		}
+		for _, rule := range rules {
+			target[LintRule(rule)] = true
+			blockIgnored[LintRule(rule)] = true
+		}
+	}
+
+	finish := func() {
+		text := strings.Join(strings.Fields(strings.ToLower(sql.String())), " ")
+		if text != "" {
+			current.sql = text
+			statements = append(statements, current)
+		}
+		current = lintStatement{ignored: map[LintRule]bool{}}
+		sql.Reset()
+		lastEndLine = line
+	}
+
+	write := func(s string) {
+		if sql.Len() == 0 && strings.TrimSpace(s) == "" {
+			return
+		}
+		if sql.Len() == 0 {
+			current.line = line
+		}
+		sql.WriteString(s)
+	}
+
+	// skip the migrate directive line
+	i := strings.IndexByte(block, '\n')
+	if i < 0 {
+		return statements, blockIgnored
+	}
+	addIgnored(block[:i])
+
+	for i < len(block) {
+		ch := block[i]
+		switch {
+		case ch == '\n':
+			line++
+			write(" ")
+			i++
+		case strings.HasPrefix(block[i:], "--"):
+			end := strings.IndexByte(block[i:], '\n')
+			if end < 0 {
+				end = len(block) - i
+			}
+			addIgnored(block[i : i+end])
+			i += end
+		case strings.HasPrefix(block[i:], "/*"):
+			end := strings.Index(block[i+2:], "*/")
+			if end < 0 {
+				end = len(block) - i - 2
+			}
+			comment := block[i : i+2+end]
+			addIgnored(comment)
+			line += strings.Count(comment, "\n")
+			write(" ")
+			i += 2 + end + 2
+		case ch == '\'' || ch == '"' || ch == '`':
+			end := strings.IndexByte(block[i+1:], ch)
+			if end < 0 {
+				end = len(block) - i - 1
+			}
+			quoted := block[i:min(i+2+end, len(block))]
+			write(quoted)
+			line += strings.Count(quoted, "\n")
+			i += len(quoted)
+		case ch == '$':
+			// postgres dollar quoted string, e.g. $body$ ... $body$
+			if tag := dollarQuoteRegExp.FindString(block[i:]); tag != "" {
+				end := strings.Index(block[i+len(tag):], tag)
+				if end < 0 {
+					end = len(block) - i - len(tag)
+				}
+				quoted := block[i:min(i+len(tag)+end+len(tag), len(block))]
+				write(quoted)
+				line += strings.Count(quoted, "\n")
+				i += len(quoted)
+			} else {
+				write("$")
+				i++
+			}
+		case ch == ';':
+			finish()
+			i++
+		default:
+			write(string(ch))
+			i++
+		}
+	}
+	finish()
+
+	return statements, blockIgnored
+}
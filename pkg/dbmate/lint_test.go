@@ -0,0 +1,149 @@
+package dbmate
+
+import (
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func issueStrings(issues []LintIssue) []string {
+	lines := []string{}
+	for _, issue := range issues {
+		lines = append(lines, issue.String())
+	}
+
+	return lines
+}
+
+func TestLintMigration(t *testing.T) {
+	t.Run("postgres", func(t *testing.T) {
+		contents := `-- migrate:up
+create table users (id serial, name text);
+create index users_name_idx on users (name);
+create index posts_user_id_idx on posts (user_id);
+CREATE UNIQUE INDEX
+  comments_user_id_idx ON comments (user_id);
+create index concurrently posts_title_idx on posts (title);
+alter table posts add column published boolean not null;
+alter table posts add column draft boolean not null default false;
+alter table posts drop column body;
+drop table comments;
+-- migrate:down
+`
+		issues := lintMigration("postgres", "db/migrations/001_test.sql", contents, map[LintRule]bool{})
+		require.Equal(t, []string{
+			"db/migrations/001_test.sql:4: create-index-concurrently: CREATE INDEX without CONCURRENTLY blocks writes to the table while the index is built",
+			"db/migrations/001_test.sql:5: create-index-concurrently: CREATE INDEX without CONCURRENTLY blocks writes to the table while the index is built",
+			"db/migrations/001_test.sql:7: concurrently-in-transaction: CONCURRENTLY cannot run inside a transaction, add transaction:false to the migrate directive",
+			"db/migrations/001_test.sql:8: add-column-not-null: adding a NOT NULL column without a DEFAULT fails if the table contains rows",
+			"db/migrations/001_test.sql:10: drop-column: DROP COLUMN permanently deletes data, and breaks code still reading the column",
+			"db/migrations/001_test.sql:11: drop-table: DROP TABLE permanently deletes data, and breaks code still reading the table",
+			"db/migrations/001_test.sql:12: missing-down: migration has an empty down block, and cannot be rolled back",
+		}, issueStrings(issues))
+	})
+
+	t.Run("mysql", func(t *testing.T) {
+		contents := `-- migrate:up
+create index posts_user_id_idx on posts (user_id);
+alter table posts add column published boolean not null;
+-- migrate:down
+alter table posts drop column published;
+`
+		issues := lintMigration("mysql", "001_test.sql", contents, map[LintRule]bool{})
+		require.Equal(t, []string{
+			"001_test.sql:3: add-column-not-null: adding a NOT NULL column without a DEFAULT fails if the table contains rows",
+		}, issueStrings(issues))
+	})
+
+	t.Run("transaction false", func(t *testing.T) {
+		contents := `-- migrate:up transaction:false
+create index concurrently posts_title_idx on posts (title);
+-- migrate:down transaction:false
+drop index posts_title_idx;
+`
+		issues := lintMigration("postgres", "001_test.sql", contents, map[LintRule]bool{})
+		require.Equal(t, []string{
+			"001_test.sql:3: transaction-false: transaction:false is only needed for statements which cannot run in a transaction, and a failure may leave the migration partially applied",
+		}, issueStrings(issues))
+	})
+
+	t.Run("ignore comments", func(t *testing.T) {
+		contents := `-- migrate:up
+-- dbmate:lint-ignore drop-table
+drop table comments;
+drop table posts; -- dbmate:lint-ignore
+/* dbmate:lint-ignore drop-column, add-column-not-null */
+alter table users drop column name, add column email text not null;
+drop table users;
+-- migrate:down
+-- dbmate:lint-ignore missing-down
+`
+		issues := lintMigration("postgres", "001_test.sql", contents, map[LintRule]bool{})
+		require.Equal(t, []string{
+			"001_test.sql:7: drop-table: DROP TABLE permanently deletes data, and breaks code still reading the table",
+		}, issueStrings(issues))
+	})
+
+	t.Run("quoted semicolons", func(t *testing.T) {
+		contents := `-- migrate:up
+insert into notes (body) values ('drop table users; --');
+create function noop() returns void as $$ begin drop table users; end; $$ language plpgsql;
+-- migrate:down
+drop function noop();
+`
+		issues := lintMigration("postgres", "001_test.sql", contents, map[LintRule]bool{})
+		require.Empty(t, issues)
+	})
+
+	t.Run("disabled rules", func(t *testing.T) {
+		contents := `-- migrate:up
+drop table comments;
+-- migrate:down
+`
+		issues := lintMigration("sqlite3", "001_test.sql", contents, map[LintRule]bool{
+			LintDropTable:   true,
+			LintMissingDown: true,
+		})
+		require.Empty(t, issues)
+	})
+
+	t.Run("invalid migration", func(t *testing.T) {
+		issues := lintMigration("postgres", "001_test.sql", "drop table comments;\n", map[LintRule]bool{
+			LintDropTable: true,
+		})
+		require.Equal(t, []string{
+			"001_test.sql:1: invalid-migration: dbmate requires each migration to define an up block with '-- migrate:up'",
+		}, issueStrings(issues))
+	})
+}
+
+func TestLintAll(t *testing.T) {
+	// no database connection is required to lint all migrations
+	db := New(&url.URL{Scheme: "postgres", Host: "127.0.0.1:1"})
+	db.FS = fstest.MapFS{
+		"db/migrations/001_create_users.sql": {
+			Data: []byte("-- migrate:up\ncreate table users (id serial);\n-- migrate:down\ndrop table users;\n"),
+		},
+		"db/migrations/002_drop_users.sql": {
+			Data: []byte("-- migrate:up\ndrop table users;\n-- migrate:down\n"),
+		},
+	}
+
+	issues, err := db.Lint(LintOptions{All: true, Disabled: []LintRule{LintMissingDown}})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"db/migrations/002_drop_users.sql:2: drop-table: DROP TABLE permanently deletes data, and breaks code still reading the table",
+	}, issueStrings(issues))
+}
+
+func TestParseLintRule(t *testing.T) {
+	rule, err := ParseLintRule("drop-table")
+	require.NoError(t, err)
+	require.Equal(t, LintDropTable, rule)
+
+	_, err = ParseLintRule("invalid-migration")
+	require.ErrorIs(t, err, ErrUnsupportedLintRule)
+	require.EqualError(t, err, "unsupported lint rule: invalid-migration")
+}
@@ -0,0 +1,111 @@
+package dbmate
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types, recorded in the "event" attribute of each structured log record
+const (
+	EventWait                = "wait"
+	EventDatabaseCreate      = "database_create"
+	EventDatabaseDrop        = "database_drop"
+	EventSchemaCreate        = "schema_create"
+	EventBackup              = "backup"
+	EventSchemaDump          = "schema_dump"
+	EventMigrationCreate     = "migration_create"
+	EventMigrationStart      = "migration_start"
+	EventMigrationFinish     = "migration_finish"
+	EventMigrationError      = "migration_error"
+	EventMigrationResult     = "migration_result"
+	EventMigrationSkip       = "migration_skip"
+	EventMigrationOutOfOrder = "migration_out_of_order"
+	EventMigrationRenumber   = "migration_renumber"
+	EventMigrationImport     = "migration_import"
+	EventMigrationTest       = "migration_test"
+	EventHistoryImport       = "history_import"
+	EventSeedStart           = "seed_start"
+	EventSeedReset           = "seed_reset"
+	EventRollbackStart       = "rollback_start"
+	EventRollbackFinish      = "rollback_finish"
+	EventRollbackError       = "rollback_error"
+	EventDatabaseResult      = "database_result"
+	EventHook                = "hook"
+)
+
+// EventKey is the structured log attribute which identifies the event type
+const EventKey = "event"
+
+// NewTextHandler returns a slog.Handler which writes human readable messages to w.
+// Only the message of info and warning records is written, one per line.
+// Debug records (such as migration durations) carry structured details only,
+// and errors are returned to the caller rather than logged.
+func NewTextHandler(w io.Writer) slog.Handler {
+	return &textHandler{w: w, mu: &sync.Mutex{}}
+}
+
+type textHandler struct {
+	w  io.Writer
+	mu *sync.Mutex
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= slog.LevelInfo && level < slog.LevelError
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	_, err := io.WriteString(h.w, r.Message+"\n")
+	return err
+}
+
+func (h *textHandler) WithAttrs(_ []slog.Attr) slog.Handler {
+	return h
+}
+
+func (h *textHandler) WithGroup(_ string) slog.Handler {
+	return h
+}
+
+// logger returns the structured logger, falling back to human readable
+// messages written to db.Log
+func (db *DB) logger() *slog.Logger {
+	if db.Logger != nil {
+		return db.Logger
+	}
+
+	return slog.New(NewTextHandler(db.Log))
+}
+
+// migrationAttrs returns the log attributes describing a migration
+func migrationAttrs(event string, migration *Migration) []any {
+	return []any{
+		EventKey, event,
+		"version", migration.Version,
+		"file", migration.FilePath,
+	}
+}
+
+// logMigrationFinish logs the duration and result of a successful migration or rollback
+func (db *DB) logMigrationFinish(event string, migration *Migration, start time.Time, result sql.Result) {
+	attrs := append(migrationAttrs(event, migration), "duration", time.Since(start))
+	if result != nil {
+		if rowsAffected, err := result.RowsAffected(); err == nil {
+			attrs = append(attrs, "rows_affected", rowsAffected)
+		}
+	}
+
+	db.logger().Debug("Finished: "+migration.FileName, attrs...)
+}
+
+// logMigrationError logs the duration and error of a failed migration or rollback
+func (db *DB) logMigrationError(event string, migration *Migration, start time.Time, err error) {
+	attrs := append(migrationAttrs(event, migration), "duration", time.Since(start), "error", err)
+	db.logger().Error("Failed: "+migration.FileName, attrs...)
+}
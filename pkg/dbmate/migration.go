@@ -2,31 +2,127 @@ package dbmate
 
 import (
 	"errors"
+	"fmt"
 	"io/fs"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 )
 
 // Migration represents an available migration and status
 type Migration struct {
-	Applied  bool
-	FileName string
-	FilePath string
-	FS       fs.FS
-	Version  string
+	Applied bool
+	// Depends lists the migrations this migration depends on, by version or name
+	Depends []string
+	// DownFilePath is the path of the .down.sql file of a split migration, if it exists
+	DownFilePath string
+	FileName     string
+	FilePath     string
+	FS           fs.FS
+	// SkipReason explains why a pending migration will not be applied, or is empty
+	SkipReason string
+	Version    string
 }
 
-func (m *Migration) readFile() (string, error) {
+// splitMigrationRegExp matches the files of a split migration, e.g. 001_users.up.sql
+var splitMigrationRegExp = regexp.MustCompile(`^(.*)\.(up|down)\.sql$`)
+
+// IsSplit returns true if the up and down blocks of the migration are stored in
+// separate VERSION_name.up.sql and VERSION_name.down.sql files
+func (m *Migration) IsSplit() bool {
+	return splitMigrationRegExp.MatchString(m.FileName)
+}
+
+func (m *Migration) readPath(path string) (string, error) {
 	if m.FS == nil {
-		bytes, err := os.ReadFile(m.FilePath)
+		bytes, err := os.ReadFile(path)
 		return string(bytes), err
 	}
 
-	bytes, err := fs.ReadFile(m.FS, m.FilePath)
+	bytes, err := fs.ReadFile(m.FS, path)
 	return string(bytes), err
 }
 
+// readFile returns the contents of the migration. The files of a split migration
+// are combined, adding the block directives if either file does not start with one.
+func (m *Migration) readFile() (string, error) {
+	contents, _, err := m.readContents()
+	return contents, err
+}
+
+// readContents returns the contents of the migration, and the layout of the files
+// of a split migration within the contents
+func (m *Migration) readContents() (string, *splitLayout, error) {
+	if !m.IsSplit() {
+		contents, err := m.readPath(m.FilePath)
+		return contents, nil, err
+	}
+
+	up, down := "", ""
+	var err error
+	// FilePath is only a down file if the up file is missing
+	hasUp := !strings.HasSuffix(m.FilePath, ".down.sql")
+	if hasUp {
+		if up, err = m.readPath(m.FilePath); err != nil {
+			return "", nil, err
+		}
+	}
+	if m.DownFilePath != "" {
+		if down, err = m.readPath(m.DownFilePath); err != nil {
+			return "", nil, err
+		}
+	}
+
+	return combineSplitMigration(up, down, hasUp, m.DownFilePath != "")
+}
+
+// splitLayout describes where the files of a split migration appear in the combined contents
+type splitLayout struct {
+	// upShift is the number of lines added before the up file
+	upShift int
+	// downStart is the first line of the down block in the combined contents
+	downStart int
+	// downShift is the number of lines added before the down file
+	downShift int
+}
+
+// combineSplitMigration joins the up and down files of a split migration. Migration
+// options may be specified with a block directive on the first line of each file,
+// e.g. "-- migrate:up transaction:false". If either file is missing, the contents
+// are missing that block, and fail to parse.
+func combineSplitMigration(up, down string, hasUp, hasDown bool) (string, *splitLayout, error) {
+	if downRegExp.MatchString(up) || upRegExp.MatchString(down) {
+		return "", nil, ErrParseSplitDirective
+	}
+
+	layout := &splitLayout{}
+	if hasUp && !upRegExp.MatchString(strings.SplitN(up, "\n", 2)[0]) {
+		up = "-- migrate:up\n" + up
+		layout.upShift = 1
+	}
+	if up != "" && !strings.HasSuffix(up, "\n") {
+		up += "\n"
+	}
+	if hasDown && !downRegExp.MatchString(strings.SplitN(down, "\n", 2)[0]) {
+		down = "-- migrate:down\n" + down
+		layout.downShift = 1
+	}
+	layout.downStart = strings.Count(up, "\n") + 1
+
+	return up + down, layout, nil
+}
+
+// sourceLine returns the file and line number for a line of the combined contents
+func (l *splitLayout) sourceLine(m *Migration, line int) (string, int) {
+	if line >= l.downStart {
+		return m.DownFilePath, max(line-l.downStart+1-l.downShift, 1)
+	}
+
+	return m.FilePath, max(line-l.upShift, 1)
+}
+
 // Parse a migration
 func (m *Migration) Parse() (*ParsedMigration, error) {
 	contents, err := m.readFile()
@@ -48,6 +144,11 @@ type ParsedMigration struct {
 // ParsedMigrationOptions is an interface for accessing migration options
 type ParsedMigrationOptions interface {
 	Transaction() bool
+	Timeout() time.Duration
+	LockTimeout() time.Duration
+	Environments() []string
+	Drivers() []string
+	AllowOutOfOrder() bool
 }
 
 type migrationOptions map[string]string
@@ -58,6 +159,93 @@ func (m migrationOptions) Transaction() bool {
 	return m["transaction"] != "false"
 }
 
+// Timeout returns the statement timeout for this migration
+// Defaults to zero, which means the global default applies.
+// MySQL only enforces it for SELECT statements.
+func (m migrationOptions) Timeout() time.Duration {
+	d, _ := time.ParseDuration(m["timeout"])
+	return d
+}
+
+// LockTimeout returns the lock timeout for this migration
+// Defaults to zero, which means the global default applies.
+func (m migrationOptions) LockTimeout() time.Duration {
+	d, _ := time.ParseDuration(m["lock_timeout"])
+	return d
+}
+
+// Environments returns the environments this migration is restricted to
+// Defaults to nil, which means all environments.
+func (m migrationOptions) Environments() []string {
+	return splitOptionList(m["env"])
+}
+
+// Drivers returns the driver URL schemes this migration is restricted to
+// Defaults to nil, which means all drivers.
+func (m migrationOptions) Drivers() []string {
+	return splitOptionList(m["driver"])
+}
+
+// AllowOutOfOrder returns whether this migration may be applied after newer migrations,
+// regardless of the out of order policy. Defaults to false.
+func (m migrationOptions) AllowOutOfOrder() bool {
+	return m["allow_out_of_order"] == "true"
+}
+
+// splitOptionList splits a comma separated option value, ignoring empty items
+func splitOptionList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// migrationOptionKeys lists the supported migration options
+var migrationOptionKeys = []string{"transaction", "timeout", "lock_timeout", "env", "driver", "allow_out_of_order"}
+
+// validate checks that option keys are supported and option values are well-formed
+func (m migrationOptions) validate() error {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		if !slices.Contains(migrationOptionKeys, key) {
+			return fmt.Errorf("%w `%s:%s`", ErrParseInvalidOption, key, m[key])
+		}
+	}
+
+	for _, key := range []string{"transaction", "allow_out_of_order"} {
+		if value, ok := m[key]; ok && value != "true" && value != "false" {
+			return fmt.Errorf("%w `%s:%s`", ErrParseInvalidOption, key, value)
+		}
+	}
+
+	for _, key := range []string{"timeout", "lock_timeout"} {
+		value, ok := m[key]
+		if !ok {
+			continue
+		}
+
+		if d, err := time.ParseDuration(value); err != nil || d < 0 {
+			return fmt.Errorf("%w `%s:%s`", ErrParseInvalidOption, key, value)
+		}
+	}
+
+	for _, key := range []string{"env", "driver"} {
+		if value, ok := m[key]; ok && len(splitOptionList(value)) == 0 {
+			return fmt.Errorf("%w `%s:%s`", ErrParseInvalidOption, key, value)
+		}
+	}
+
+	return nil
+}
+
 var (
 	upRegExp              = regexp.MustCompile(`(?m)^--\s*migrate:up(\s*$|\s+\S+)`)
 	downRegExp            = regexp.MustCompile(`(?m)^--\s*migrate:down(\s*$|\s+\S+)`)
@@ -74,6 +262,8 @@ var (
 	ErrParseMissingDown    = errors.New("dbmate requires each migration to define a down block with '-- migrate:down'")
 	ErrParseWrongOrder     = errors.New("dbmate requires '-- migrate:up' to appear before '-- migrate:down'")
 	ErrParseUnexpectedStmt = errors.New("dbmate does not support statements preceding the '-- migrate:up' block")
+	ErrParseInvalidOption  = errors.New("dbmate does not support the migration option")
+	ErrParseSplitDirective = errors.New("dbmate requires split migration files to contain only their own '-- migrate:up' or '-- migrate:down' block")
 )
 
 // parseMigrationContents parses the string contents of a migration.
@@ -101,11 +291,20 @@ func parseMigrationContents(contents string) (*ParsedMigration, error) {
 	upBlock := substring(contents, upDirectiveStart, downDirectiveStart)
 	downBlock := substring(contents, downDirectiveStart, len(contents))
 
+	upOptions := parseMigrationOptions(upBlock)
+	if err := upOptions.(migrationOptions).validate(); err != nil {
+		return nil, err
+	}
+	downOptions := parseMigrationOptions(downBlock)
+	if err := downOptions.(migrationOptions).validate(); err != nil {
+		return nil, err
+	}
+
 	parsed := ParsedMigration{
 		Up:          upBlock,
-		UpOptions:   parseMigrationOptions(upBlock),
+		UpOptions:   upOptions,
 		Down:        downBlock,
-		DownOptions: parseMigrationOptions(downBlock),
+		DownOptions: downOptions,
 	}
 	return &parsed, nil
 }
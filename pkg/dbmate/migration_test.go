@@ -1,8 +1,11 @@
 package dbmate
 
 import (
+	"errors"
+	"strings"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -100,6 +103,90 @@ ALTER TYPE colors ADD VALUE 'orange' AFTER 'red';
 		require.Equal(t, false, parsed.DownOptions.Transaction())
 	})
 
+	t.Run("support timeouts", func(t *testing.T) {
+		migration := `-- migrate:up timeout:30s lock_timeout:500ms
+ALTER TABLE users ADD COLUMN email text;
+-- migrate:down
+ALTER TABLE users DROP COLUMN email;
+`
+
+		parsed, err := parseMigrationContents(migration)
+		require.Nil(t, err)
+
+		require.Equal(t, 30*time.Second, parsed.UpOptions.Timeout())
+		require.Equal(t, 500*time.Millisecond, parsed.UpOptions.LockTimeout())
+		require.Equal(t, true, parsed.UpOptions.Transaction())
+
+		require.Equal(t, time.Duration(0), parsed.DownOptions.Timeout())
+		require.Equal(t, time.Duration(0), parsed.DownOptions.LockTimeout())
+	})
+
+	t.Run("reject invalid timeouts", func(t *testing.T) {
+		migration := `-- migrate:up
+ALTER TABLE users ADD COLUMN email text;
+-- migrate:down lock_timeout:soon
+ALTER TABLE users DROP COLUMN email;
+`
+
+		_, err := parseMigrationContents(migration)
+		require.True(t, errors.Is(err, ErrParseInvalidOption))
+		require.EqualError(t, err, "dbmate does not support the migration option `lock_timeout:soon`")
+	})
+
+	t.Run("support environments", func(t *testing.T) {
+		migration := `-- migrate:up env:production,staging
+INSERT INTO settings VALUES ('mode', 'live');
+-- migrate:down
+DELETE FROM settings WHERE key = 'mode';
+`
+
+		parsed, err := parseMigrationContents(migration)
+		require.Nil(t, err)
+
+		require.Equal(t, []string{"production", "staging"}, parsed.UpOptions.Environments())
+		require.Empty(t, parsed.DownOptions.Environments())
+	})
+
+	t.Run("support drivers", func(t *testing.T) {
+		migration := `-- migrate:up driver:postgres,clickhouse
+CREATE TABLE events (id bigint);
+-- migrate:down
+DROP TABLE events;
+`
+
+		parsed, err := parseMigrationContents(migration)
+		require.Nil(t, err)
+
+		require.Equal(t, []string{"postgres", "clickhouse"}, parsed.UpOptions.Drivers())
+	})
+
+	t.Run("support allowing out of order", func(t *testing.T) {
+		migration := `-- migrate:up allow_out_of_order:true
+ALTER TABLE users ADD COLUMN email text;
+-- migrate:down
+ALTER TABLE users DROP COLUMN email;
+`
+
+		parsed, err := parseMigrationContents(migration)
+		require.Nil(t, err)
+
+		require.True(t, parsed.UpOptions.AllowOutOfOrder())
+		require.False(t, parsed.DownOptions.AllowOutOfOrder())
+
+		_, err = parseMigrationContents(strings.Replace(migration, ":true", ":yes", 1))
+		require.EqualError(t, err, "dbmate does not support the migration option `allow_out_of_order:yes`")
+	})
+
+	t.Run("reject empty environments", func(t *testing.T) {
+		migration := `-- migrate:up env:
+INSERT INTO settings VALUES ('mode', 'live');
+-- migrate:down
+`
+
+		_, err := parseMigrationContents(migration)
+		require.True(t, errors.Is(err, ErrParseInvalidOption))
+	})
+
 	t.Run("require migrate blocks", func(t *testing.T) {
 		migration := `
 ALTER TABLE users
@@ -200,3 +287,49 @@ DROP COLUMN status;
 		})
 	})
 }
+
+func TestParseSplitMigration(t *testing.T) {
+	fs := fstest.MapFS{
+		"db/001_users.up.sql":   {Data: []byte("-- migrate:up transaction:false\ncreate table users (id serial);")},
+		"db/001_users.down.sql": {Data: []byte("drop table users;\n")},
+		"db/002_posts.up.sql":   {Data: []byte("create table posts (id serial);\n-- migrate:down\n")},
+	}
+
+	migration := &Migration{
+		DownFilePath: "db/001_users.down.sql",
+		FileName:     "001_users.up.sql",
+		FilePath:     "db/001_users.up.sql",
+		FS:           fs,
+		Version:      "001",
+	}
+	require.True(t, migration.IsSplit())
+
+	parsed, err := migration.Parse()
+	require.NoError(t, err)
+	require.Equal(t, "-- migrate:up transaction:false\ncreate table users (id serial);\n", parsed.Up)
+	require.False(t, parsed.UpOptions.Transaction())
+	require.Equal(t, "-- migrate:down\ndrop table users;\n", parsed.Down)
+	require.True(t, parsed.DownOptions.Transaction())
+
+	// missing files
+	migration.DownFilePath = ""
+	_, err = migration.Parse()
+	require.ErrorIs(t, err, ErrParseMissingDown)
+
+	migration.FileName = "001_users.down.sql"
+	migration.FilePath = "db/001_users.down.sql"
+	migration.DownFilePath = "db/001_users.down.sql"
+	_, err = migration.Parse()
+	require.ErrorIs(t, err, ErrParseMissingUp)
+
+	// directives for the other block
+	migration = &Migration{
+		DownFilePath: "db/001_users.down.sql",
+		FileName:     "002_posts.up.sql",
+		FilePath:     "db/002_posts.up.sql",
+		FS:           fs,
+		Version:      "002",
+	}
+	_, err = migration.Parse()
+	require.ErrorIs(t, err, ErrParseSplitDirective)
+}
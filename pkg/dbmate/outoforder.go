@@ -0,0 +1,124 @@
+package dbmate
+
+import (
+	"errors"
+	"fmt"
+)
+
+// OutOfOrderPolicy specifies how pending migrations older than applied migrations are handled
+type OutOfOrderPolicy string
+
+// Out of order policies
+const (
+	// OutOfOrderApply applies out of order migrations
+	OutOfOrderApply OutOfOrderPolicy = "apply"
+	// OutOfOrderWarn applies out of order migrations, and logs a warning for each
+	OutOfOrderWarn OutOfOrderPolicy = "warn"
+	// OutOfOrderFail fails without applying any migrations
+	OutOfOrderFail OutOfOrderPolicy = "fail"
+)
+
+// ErrUnsupportedOutOfOrderPolicy is returned for an unknown out of order policy
+var ErrUnsupportedOutOfOrderPolicy = errors.New("unsupported out of order policy")
+
+// ParseOutOfOrderPolicy validates an out of order policy name
+func ParseOutOfOrderPolicy(name string) (OutOfOrderPolicy, error) {
+	switch policy := OutOfOrderPolicy(name); policy {
+	case OutOfOrderApply, OutOfOrderWarn, OutOfOrderFail:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedOutOfOrderPolicy, name)
+}
+
+// outOfOrderPolicy returns the policy in effect, where Strict is equivalent to OutOfOrderFail
+func (db *DB) outOfOrderPolicy() (OutOfOrderPolicy, error) {
+	if db.Strict {
+		return OutOfOrderFail, nil
+	}
+	if db.AllowOutOfOrder == "" {
+		return OutOfOrderApply, nil
+	}
+
+	return ParseOutOfOrderPolicy(string(db.AllowOutOfOrder))
+}
+
+// outOfOrderMigration is a pending migration which is older than an applied migration
+type outOfOrderMigration struct {
+	migration *Migration
+	// after is the version of the applied migration it is older than, or which depends on it
+	after string
+}
+
+// findOutOfOrder returns the pending migrations which are out of order, excluding those
+// which allow it with the allow_out_of_order option. Without dependencies, migrations
+// are out of order if their version is not higher than the highest applied version.
+// With dependencies, migrations are out of order only if an applied migration depends on them.
+func findOutOfOrder(migrations []Migration, pending []Migration) []outOfOrderMigration {
+	dependents := map[string]string{}
+	highestApplied := ""
+	graph := hasDependencies(migrations)
+	if graph {
+		dependents = appliedDependents(migrations)
+	} else {
+		for _, migration := range migrations {
+			if migration.Applied && compareVersions(highestApplied, migration.Version) <= 0 {
+				highestApplied = migration.Version
+			}
+		}
+	}
+
+	result := []outOfOrderMigration{}
+	for i := range pending {
+		migration := &pending[i]
+		after, ok := dependents[migration.Version]
+		if !graph && highestApplied != "" && compareVersions(migration.Version, highestApplied) <= 0 {
+			after, ok = highestApplied, true
+		}
+		if ok && !allowsOutOfOrder(migration) {
+			result = append(result, outOfOrderMigration{migration: migration, after: after})
+		}
+	}
+
+	return result
+}
+
+// allowsOutOfOrder returns true if a migration has the allow_out_of_order option
+func allowsOutOfOrder(migration *Migration) bool {
+	parsed, err := migration.Parse()
+	if err != nil {
+		return false
+	}
+
+	return parsed.UpOptions.AllowOutOfOrder()
+}
+
+// checkOutOfOrder applies the out of order policy to pending migrations
+func (db *DB) checkOutOfOrder(migrations []Migration, pending []Migration) error {
+	policy, err := db.outOfOrderPolicy()
+	if err != nil {
+		return err
+	}
+	if policy == OutOfOrderApply {
+		return nil
+	}
+
+	mode := "with --allow-out-of-order=fail"
+	if db.Strict {
+		mode = "in --strict mode"
+	}
+
+	for _, o := range findOutOfOrder(migrations, pending) {
+		if policy == OutOfOrderFail {
+			if hasDependencies(migrations) {
+				return fmt.Errorf("migration `%s` is out of order with already applied migrations, the applied migration `%s` depends on it %s", o.migration.Version, o.after, mode)
+			}
+			return fmt.Errorf("migration `%s` is out of order with already applied migrations, the version number has to be higher than the applied migration `%s` %s", o.migration.Version, o.after, mode)
+		}
+
+		db.logger().Warn(fmt.Sprintf("Applying out of order: %s (after applied migration %s)", o.migration.FileName, o.after),
+			EventKey, EventMigrationOutOfOrder, "version", o.migration.Version, "file", o.migration.FilePath, "after", o.after)
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package dbmate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOutOfOrderPolicy(t *testing.T) {
+	policy, err := ParseOutOfOrderPolicy("warn")
+	require.NoError(t, err)
+	require.Equal(t, OutOfOrderWarn, policy)
+
+	_, err = ParseOutOfOrderPolicy("ignore")
+	require.ErrorIs(t, err, ErrUnsupportedOutOfOrderPolicy)
+}
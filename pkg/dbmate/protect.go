@@ -0,0 +1,72 @@
+package dbmate
+
+import (
+	"errors"
+	"fmt"
+	"path"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+)
+
+// ErrDatabaseProtected is returned when dropping a database listed in ProtectedDatabases
+var ErrDatabaseProtected = errors.New("refusing to drop a protected database, use --force to drop it anyway")
+
+// DatabaseName returns the name of the database in DatabaseURL, such as the file
+// path for SQLite, or an empty string if DatabaseURL is not set
+func (db *DB) DatabaseName() string {
+	if db.DatabaseURL == nil {
+		return ""
+	}
+
+	if canonicalDriver(db.DatabaseURL.Scheme) == "sqlite" {
+		// sqlite urls such as sqlite:app.sqlite3 have an opaque path, and absolute
+		// paths such as sqlite:/var/app.sqlite3 keep their leading slash
+		if db.DatabaseURL.Opaque != "" {
+			return db.DatabaseURL.Opaque
+		}
+		return db.DatabaseURL.Path
+	}
+
+	return dbutil.DatabaseName(db.DatabaseURL)
+}
+
+// DatabaseHost returns the host of DatabaseURL, without credentials, or an empty
+// string if there is no host (such as for SQLite)
+func (db *DB) DatabaseHost() string {
+	if db.DatabaseURL == nil {
+		return ""
+	}
+
+	return db.DatabaseURL.Hostname()
+}
+
+// protectedBy returns the ProtectedDatabases pattern which matches the database
+// name or host, or an empty string if the database is not protected
+func (db *DB) protectedBy() string {
+	name, host := db.DatabaseName(), db.DatabaseHost()
+	for _, pattern := range db.ProtectedDatabases {
+		for _, value := range []string{name, host} {
+			if value == "" {
+				continue
+			}
+			if ok, _ := path.Match(pattern, value); ok {
+				return pattern
+			}
+		}
+	}
+
+	return ""
+}
+
+// CheckProtected returns ErrDatabaseProtected if the database matches ProtectedDatabases
+// and Force is not set, so that this can be checked before asking for confirmation
+func (db *DB) CheckProtected() error {
+	if db.Force {
+		return nil
+	}
+	if pattern := db.protectedBy(); pattern != "" {
+		return fmt.Errorf("%w (matches `%s`)", ErrDatabaseProtected, pattern)
+	}
+
+	return nil
+}
@@ -0,0 +1,177 @@
+package dbmate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+)
+
+// Error codes
+var (
+	ErrRoundTripFailed   = errors.New("rolling back migration did not restore the schema")
+	ErrNoScratchURL      = errors.New("testing migrations requires a scratch database URL")
+	ErrScratchIsDatabase = errors.New("the scratch database must not be the database being migrated")
+)
+
+// TestMigrations checks that the down block of each migration reverses its up block
+func (db *DB) TestMigrations() error {
+	return db.TestMigrationsContext(context.Background())
+}
+
+// TestMigrationsContext checks that the down block of each migration reverses its up block.
+// The database at ScratchURL is dropped and recreated, and DatabaseURL is never used. Each
+// migration is applied, rolled back, and applied again, and the schema after rolling back
+// must match the schema before applying. The first migration which fails this is reported.
+func (db *DB) TestMigrationsContext(ctx context.Context) error {
+	ctx, span := db.startSpan(ctx, "dbmate.test_migrations")
+	err := db.testMigrations(ctx)
+	endSpan(span, err)
+
+	return err
+}
+
+// scratchDB returns a copy of db for ScratchURL, refusing a scratch database which is
+// the same as DatabaseURL
+func (db *DB) scratchDB() (*DB, error) {
+	if db.ScratchURL == nil || db.ScratchURL.String() == "" {
+		return nil, ErrNoScratchURL
+	}
+
+	scratch := *db
+	scratch.DatabaseURL = db.ScratchURL
+	scratch.AutoDumpSchema = false
+	if db.DatabaseURL != nil && db.DatabaseURL.String() != "" &&
+		canonicalDriver(scratch.DatabaseURL.Scheme) == canonicalDriver(db.DatabaseURL.Scheme) &&
+		scratch.DatabaseURL.Host == db.DatabaseURL.Host &&
+		scratch.DatabaseName() == db.DatabaseName() {
+		return nil, fmt.Errorf("%w `%s`", ErrScratchIsDatabase, db.DatabaseName())
+	}
+
+	return &scratch, nil
+}
+
+func (db *DB) testMigrations(ctx context.Context) error {
+	scratch, err := db.scratchDB()
+	if err != nil {
+		return err
+	}
+
+	return scratch.testScratchMigrations(ctx)
+}
+
+// testScratchMigrations tests migrations against db, which is a scratch database
+func (db *DB) testScratchMigrations(ctx context.Context) error {
+	migrations, err := db.migrationFiles()
+	if err != nil {
+		return err
+	}
+	if len(migrations) == 0 {
+		return ErrNoMigrationFiles
+	}
+	db.markSkipped(migrations)
+
+	if err := db.DropContext(ctx); err != nil {
+		return err
+	}
+	if err := db.CreateContext(ctx); err != nil {
+		return err
+	}
+
+	drv, err := db.DriverContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.openDatabaseForMigration(ctx, drv)
+	if err != nil {
+		return err
+	}
+	defer dbutil.MustClose(sqlDB)
+
+	tested := 0
+	for i := range migrations {
+		migration := &migrations[i]
+		if migration.SkipReason != "" {
+			db.logger().Info(fmt.Sprintf("Skipping: %s (%s)", migration.FileName, migration.SkipReason),
+				EventKey, EventMigrationSkip, "version", migration.Version, "file", migration.FilePath, "reason", migration.SkipReason)
+			continue
+		}
+
+		parsed, err := migration.Parse()
+		if err != nil {
+			return err
+		}
+		if statements, _ := splitLintStatements(parsed.Down, 0); len(statements) == 0 {
+			return fmt.Errorf("%w `%s`: the down block is empty", ErrRoundTripFailed, migration.FileName)
+		}
+
+		before, err := contextDriver(drv).DumpSchemaContext(ctx, sqlDB)
+		if err != nil {
+			return err
+		}
+
+		if err := db.applyMigration(ctx, drv, sqlDB, migration); err != nil {
+			return err
+		}
+		if err := db.rollbackMigration(ctx, drv, sqlDB, migration); err != nil {
+			return err
+		}
+
+		after, err := contextDriver(drv).DumpSchemaContext(ctx, sqlDB)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(before, after) {
+			return fmt.Errorf("%w `%s`:\n%s", ErrRoundTripFailed, migration.FileName, schemaDiff(before, after))
+		}
+
+		// re-apply, so that the next migration is tested against the schema it expects
+		if err := db.applyMigration(ctx, drv, sqlDB, migration); err != nil {
+			return err
+		}
+		tested++
+	}
+
+	db.logger().Info(fmt.Sprintf("Tested: %d migrations", tested), EventKey, EventMigrationTest, "count", tested)
+
+	return nil
+}
+
+// schemaDiff returns the lines of the schema before applying a migration which are
+// missing after rolling it back (prefixed with "-"), and the lines which were left
+// behind (prefixed with "+")
+func schemaDiff(before, after []byte) string {
+	beforeLines := strings.Split(strings.TrimSpace(string(before)), "\n")
+	afterLines := strings.Split(strings.TrimSpace(string(after)), "\n")
+
+	count := func(lines []string) map[string]int {
+		counts := map[string]int{}
+		for _, line := range lines {
+			counts[line]++
+		}
+		return counts
+	}
+	beforeCounts, afterCounts := count(beforeLines), count(afterLines)
+
+	var sb strings.Builder
+	for _, line := range beforeLines {
+		if afterCounts[line] > 0 {
+			afterCounts[line]--
+			continue
+		}
+		sb.WriteString("- " + line + "\n")
+	}
+	for _, line := range afterLines {
+		if beforeCounts[line] > 0 {
+			beforeCounts[line]--
+			continue
+		}
+		sb.WriteString("+ " + line + "\n")
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n")
+}
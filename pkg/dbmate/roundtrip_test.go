@@ -0,0 +1,15 @@
+package dbmate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaDiff(t *testing.T) {
+	before := []byte("CREATE TABLE users (id int);\nCREATE INDEX users_id ON users (id);\n")
+	after := []byte("CREATE TABLE users (id int);\nCREATE TABLE posts (id int);\n")
+
+	require.Equal(t, "- CREATE INDEX users_id ON users (id);\n+ CREATE TABLE posts (id int);", schemaDiff(before, after))
+	require.Equal(t, "", schemaDiff(before, before))
+}
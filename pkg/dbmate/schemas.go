@@ -0,0 +1,105 @@
+package dbmate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Error codes
+var (
+	ErrSchemasUnsupported    = errors.New("migrating schemas is only supported for postgres")
+	ErrInvalidSchemaName     = errors.New("invalid schema name")
+	ErrSchemaMigrationsTable = errors.New("migrations table must not include a schema when migrating schemas")
+)
+
+// schemaNameRegExp matches schema names which can be used in search_path without quoting
+var schemaNameRegExp = regexp.MustCompile(`^[a-z_][a-z0-9_$]*$`)
+
+// MigrateSchemas migrates each schema in the database to the latest version
+func (db *DB) MigrateSchemas(schemas []string, opts DatabasesOptions) ([]DatabaseResult, error) {
+	return db.MigrateSchemasContext(context.Background(), schemas, opts)
+}
+
+// MigrateSchemasContext migrates each schema in the database to the latest version.
+// Each schema has its own migrations table, and migrations run with the schema first
+// in search_path, so that unqualified names refer to the schema. The schema is created
+// if it does not exist. The schema file is not written.
+func (db *DB) MigrateSchemasContext(ctx context.Context, schemas []string, opts DatabasesOptions) ([]DatabaseResult, error) {
+	targets, err := db.schemaTargets(schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.forEachDatabase(ctx, targets, opts, migrateTarget)
+}
+
+// StatusSchemas returns the migration status of each schema in the database
+func (db *DB) StatusSchemas(schemas []string, opts DatabasesOptions) ([]DatabaseResult, error) {
+	return db.StatusSchemasContext(context.Background(), schemas, opts)
+}
+
+// StatusSchemasContext returns the migration status of each schema in the database
+func (db *DB) StatusSchemasContext(ctx context.Context, schemas []string, opts DatabasesOptions) ([]DatabaseResult, error) {
+	targets, err := db.schemaTargets(schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.forEachDatabase(ctx, targets, opts, statusTarget)
+}
+
+// QuerySchemas runs a query against DatabaseURL which returns schema names in the first column
+func (db *DB) QuerySchemas(ctx context.Context, query string) ([]string, error) {
+	return db.queryColumn(ctx, query)
+}
+
+// schemaTargets returns a target for each schema, named after the schema
+func (db *DB) schemaTargets(schemas []string) ([]databaseTarget, error) {
+	if db.DatabaseURL == nil || db.DatabaseURL.Scheme == "" {
+		return nil, ErrInvalidURL
+	}
+	if canonicalDriver(db.DatabaseURL.Scheme) != "postgres" {
+		return nil, fmt.Errorf("%w: %s", ErrSchemasUnsupported, db.DatabaseURL.Scheme)
+	}
+	if strings.Contains(db.MigrationsTableName, ".") {
+		return nil, fmt.Errorf("%w `%s`", ErrSchemaMigrationsTable, db.MigrationsTableName)
+	}
+
+	targets := []databaseTarget{}
+	for _, schema := range schemas {
+		if !schemaNameRegExp.MatchString(schema) {
+			return nil, fmt.Errorf("%w `%s`", ErrInvalidSchemaName, schema)
+		}
+
+		targets = append(targets, databaseTarget{name: schema, url: schemaURL(db.DatabaseURL, schema)})
+	}
+
+	return targets, nil
+}
+
+// schemaURL returns a copy of u with schema first in search_path. Schemas already
+// in search_path, such as a shared schema for extensions, remain visible. If u has no
+// search_path, public remains visible, as it is in the default search_path.
+func schemaURL(u *url.URL, schema string) *url.URL {
+	searchPath := []string{schema}
+	query := u.Query()
+	for _, s := range strings.Split(query.Get("search_path"), ",") {
+		if s = strings.TrimSpace(s); s != "" && !slices.Contains(searchPath, s) {
+			searchPath = append(searchPath, s)
+		}
+	}
+	if len(searchPath) == 1 && schema != "public" {
+		searchPath = append(searchPath, "public")
+	}
+	query.Set("search_path", strings.Join(searchPath, ","))
+
+	out := *u
+	out.RawQuery = query.Encode()
+
+	return &out
+}
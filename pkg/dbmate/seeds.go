@@ -0,0 +1,159 @@
+package dbmate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbutil"
+)
+
+// ErrSeedsDirNotFound is returned when SeedsDir does not exist
+var ErrSeedsDirNotFound = errors.New("could not find seeds directory")
+
+// seedFile is a seed in SeedsDir
+type seedFile struct {
+	// Name identifies the seed in the seeds table, e.g. users.sql or development/users.sql
+	Name     string
+	FilePath string
+}
+
+// SeedOptions specifies how seeds are applied
+type SeedOptions struct {
+	// Reset forgets all applied seeds, so that every seed runs again
+	Reset bool
+}
+
+// Seed applies seed files which have not yet been applied
+func (db *DB) Seed(opts SeedOptions) error {
+	return db.SeedContext(context.Background(), opts)
+}
+
+// SeedContext applies seed files which have not yet been applied. Seeds in SeedsDir
+// apply to every environment, and seeds in a subdirectory named after Environment
+// apply only to that environment. Applied seeds are recorded in SeedsTableName.
+func (db *DB) SeedContext(ctx context.Context, opts SeedOptions) error {
+	ctx, span := db.startSpan(ctx, "dbmate.seed")
+	err := db.seed(ctx, opts)
+	endSpan(span, err)
+
+	return err
+}
+
+func (db *DB) seed(ctx context.Context, opts SeedOptions) error {
+	seeds, err := db.seedFiles()
+	if err != nil {
+		return err
+	}
+
+	drv, err := db.driver(ctx, db.SeedsTableName)
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := db.openDatabaseForMigration(ctx, drv)
+	if err != nil {
+		return err
+	}
+	defer dbutil.MustClose(sqlDB)
+
+	applied, err := contextDriver(drv).SelectMigrationsContext(ctx, sqlDB, -1)
+	if err != nil {
+		return err
+	}
+
+	if opts.Reset {
+		db.logger().Info("Resetting seeds", EventKey, EventSeedReset)
+		for _, name := range sortedKeys(applied) {
+			err := doTransaction(ctx, sqlDB, func(tx dbutil.Transaction) error {
+				return contextDriver(drv).DeleteMigrationContext(ctx, tx, name)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		applied = map[string]bool{}
+	}
+
+	for _, seed := range seeds {
+		if applied[seed.Name] {
+			continue
+		}
+
+		contents, err := db.readFile(seed.FilePath)
+		if err != nil {
+			return err
+		}
+
+		db.logger().Info("Seeding: "+seed.Name, EventKey, EventSeedStart, "seed", seed.Name, "file", seed.FilePath)
+		execSeed := func(tx dbutil.Transaction) error {
+			result, err := dbutil.ExecContext(ctx, tx, string(contents))
+			if err != nil {
+				return drv.QueryError(string(contents), err)
+			} else if db.Verbose {
+				db.printVerbose(result)
+			}
+
+			// record seed
+			return contextDriver(drv).InsertMigrationContext(ctx, tx, seed.Name)
+		}
+
+		if err := db.execMigrationBlock(ctx, drv, sqlDB, migrationOptions{}, execSeed); err != nil {
+			return fmt.Errorf("%s: %w", seed.FilePath, err)
+		}
+	}
+
+	return nil
+}
+
+// seedFiles lists the seeds for the current environment, in order of file name.
+// Seeds for all environments run before environment seeds with the same file name.
+func (db *DB) seedFiles() ([]seedFile, error) {
+	seeds, err := db.readSeedsDir(db.SeedsDir, "")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("%w `%s`", ErrSeedsDirNotFound, db.SeedsDir)
+	} else if err != nil {
+		return nil, err
+	}
+
+	if db.Environment != "" {
+		envSeeds, err := db.readSeedsDir(db.joinPath(db.SeedsDir, db.Environment), db.Environment)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		seeds = append(seeds, envSeeds...)
+	}
+
+	sort.SliceStable(seeds, func(i, j int) bool {
+		return path.Base(seeds[i].Name) < path.Base(seeds[j].Name)
+	})
+
+	return seeds, nil
+}
+
+// readSeedsDir lists the .sql files directly within dir. Names are prefixed with
+// the environment, if any.
+func (db *DB) readSeedsDir(dir, environment string) ([]seedFile, error) {
+	entries, err := db.readDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seeds := []seedFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") || path.Ext(entry.Name()) != ".sql" {
+			continue
+		}
+
+		seeds = append(seeds, seedFile{
+			Name:     path.Join(environment, entry.Name()),
+			FilePath: db.joinPath(dir, entry.Name()),
+		})
+	}
+
+	return seeds, nil
+}
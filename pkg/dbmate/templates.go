@@ -0,0 +1,154 @@
+package dbmate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/user"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate is the name of the template used when none is specified
+const DefaultTemplate = "default"
+
+// ErrTemplateNotFound is returned when a migration template does not exist
+var ErrTemplateNotFound = errors.New("can't find migration template")
+
+// builtinTemplates are available when no file with the same name exists in TemplatesDir
+var builtinTemplates = map[string]string{
+	DefaultTemplate: "-- migrate:up\n\n\n-- migrate:down\n\n",
+	"create_table": `-- migrate:up
+create table {{.Table}} (
+  id bigint primary key
+);
+
+-- migrate:down
+drop table {{.Table}};
+`,
+	"concurrent_index": `-- migrate:up transaction:false
+-- replace column_name with the indexed columns
+create index concurrently {{.Table}}_idx on {{.Table}} (column_name);
+
+-- migrate:down transaction:false
+drop index concurrently if exists {{.Table}}_idx;
+`,
+}
+
+// tableNamePrefixes are removed from migration names to guess the table name
+var tableNamePrefixes = []string{"create_", "add_", "index_"}
+
+// NewMigrationOptions specifies how a new migration file is generated
+type NewMigrationOptions struct {
+	// Template is the name of the template, or empty for DefaultTemplate
+	Template string
+	// Author is available to templates as {{.Author}}, or empty for the current user
+	Author string
+}
+
+// TemplateData holds the values available to migration templates
+type TemplateData struct {
+	// Name is the migration name, e.g. create_users
+	Name string
+	// Table is the migration name without a leading create_, add_ or index_, e.g. users
+	Table string
+	// Version is the migration version, e.g. 20151129054053
+	Version string
+	// Author is the person creating the migration
+	Author string
+	// Date is the current UTC date, e.g. 2015-11-29
+	Date string
+}
+
+// Templates returns the names of all available migration templates, including
+// built-in templates and files in TemplatesDir
+func (db *DB) Templates() ([]string, error) {
+	names := map[string]bool{}
+	for name := range builtinTemplates {
+		names[name] = true
+	}
+
+	entries, err := db.readDir(db.TemplatesDir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() && path.Ext(entry.Name()) == ".sql" {
+			names[strings.TrimSuffix(entry.Name(), ".sql")] = true
+		}
+	}
+
+	return sortedKeys(names), nil
+}
+
+// migrationTemplate returns the contents of a named template. A file named
+// NAME.sql in TemplatesDir takes precedence over a built-in template.
+func (db *DB) migrationTemplate(name string) (*template.Template, error) {
+	if name == "" {
+		name = DefaultTemplate
+	}
+
+	source, found := builtinTemplates[name]
+	if db.TemplatesDir != "" && path.Base(name) == name {
+		contents, err := db.readFile(db.joinPath(db.TemplatesDir, name+".sql"))
+		if err == nil {
+			source = string(contents)
+			found = true
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%w `%s`", ErrTemplateNotFound, name)
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid migration template `%s`: %w", name, err)
+	}
+
+	return tmpl, nil
+}
+
+// renderMigrationTemplate executes a template with data for a new migration
+func (db *DB) renderMigrationTemplate(name string, data TemplateData) ([]byte, error) {
+	tmpl, err := db.migrationTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("invalid migration template `%s`: %w", tmpl.Name(), err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// newTemplateData returns the template values for a new migration
+func newTemplateData(name, version, author string) TemplateData {
+	table := name
+	for _, prefix := range tableNamePrefixes {
+		if strings.HasPrefix(table, prefix) && len(table) > len(prefix) {
+			table = strings.TrimPrefix(table, prefix)
+			break
+		}
+	}
+
+	if author == "" {
+		if u, err := user.Current(); err == nil {
+			author = u.Username
+		}
+	}
+
+	return TemplateData{
+		Name:    name,
+		Table:   table,
+		Version: version,
+		Author:  author,
+		Date:    time.Now().UTC().Format("2006-01-02"),
+	}
+}
@@ -0,0 +1,74 @@
+package dbmate
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func readNewMigration(t *testing.T, dir string) string {
+	names := listMigrationFiles(t, dir)
+	require.Len(t, names, 1)
+
+	contents, err := os.ReadFile(filepath.Join(dir, names[0]))
+	require.NoError(t, err)
+	require.NoError(t, os.Remove(filepath.Join(dir, names[0])))
+
+	return string(contents)
+}
+
+func TestNewMigrationTemplates(t *testing.T) {
+	dir := t.TempDir()
+	db := New(nil)
+	db.Log = io.Discard
+	db.VersionStrategy = VersionSequential
+	db.MigrationsDir = []string{filepath.Join(dir, "migrations")}
+	db.TemplatesDir = filepath.Join(dir, "templates")
+
+	// built-in default template
+	require.NoError(t, db.NewMigration("create_users"))
+	require.Equal(t, "-- migrate:up\n\n\n-- migrate:down\n\n", readNewMigration(t, db.MigrationsDir[0]))
+
+	// built-in named templates
+	require.NoError(t, db.NewMigrationWithOptions("add_users", NewMigrationOptions{Template: "create_table"}))
+	require.Equal(t, "-- migrate:up\ncreate table users (\n  id bigint primary key\n);\n\n-- migrate:down\ndrop table users;\n",
+		readNewMigration(t, db.MigrationsDir[0]))
+
+	require.NoError(t, db.NewMigrationWithOptions("index_posts", NewMigrationOptions{Template: "concurrent_index"}))
+	contents := readNewMigration(t, db.MigrationsDir[0])
+	parsed, err := parseMigrationContents(contents)
+	require.NoError(t, err)
+	require.False(t, parsed.UpOptions.Transaction())
+	require.False(t, parsed.DownOptions.Transaction())
+	require.Contains(t, contents, "create index concurrently posts_idx on posts (column_name);")
+
+	// project templates override built-in templates, and support placeholders
+	require.NoError(t, os.MkdirAll(db.TemplatesDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(db.TemplatesDir, "default.sql"),
+		[]byte("-- {{.Name}} version {{.Version}} by {{.Author}} on {{.Date}}\n-- migrate:up\n\n-- migrate:down\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(db.TemplatesDir, "seed.sql"),
+		[]byte("-- migrate:up\ninsert into {{.Table}} values ();\n-- migrate:down\n"), 0o644))
+
+	require.NoError(t, db.NewMigrationWithOptions("create_posts", NewMigrationOptions{Author: "alice"}))
+	date := time.Now().UTC().Format("2006-01-02")
+	require.Equal(t, "-- create_posts version 0001 by alice on "+date+"\n-- migrate:up\n\n-- migrate:down\n",
+		readNewMigration(t, db.MigrationsDir[0]))
+
+	names, err := db.Templates()
+	require.NoError(t, err)
+	require.Equal(t, []string{"concurrent_index", "create_table", "default", "seed"}, names)
+
+	// errors
+	err = db.NewMigrationWithOptions("create_posts", NewMigrationOptions{Template: "missing"})
+	require.ErrorIs(t, err, ErrTemplateNotFound)
+	require.EqualError(t, err, "can't find migration template `missing`")
+
+	require.NoError(t, os.WriteFile(filepath.Join(db.TemplatesDir, "broken.sql"), []byte("{{.Unknown}}"), 0o644))
+	err = db.NewMigrationWithOptions("create_posts", NewMigrationOptions{Template: "broken"})
+	require.ErrorContains(t, err, "invalid migration template `broken`")
+	require.Empty(t, listMigrationFiles(t, db.MigrationsDir[0]))
+}
@@ -0,0 +1,71 @@
+package dbmate
+
+import (
+	"context"
+	"database/sql"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName identifies spans created by dbmate
+const tracerName = "github.com/amacneil/dbmate/v2/pkg/dbmate"
+
+// Span attributes
+const (
+	AttrDBSystem             = attribute.Key("db.system")
+	AttrMigrationVersion     = attribute.Key("dbmate.migration.version")
+	AttrMigrationFile        = attribute.Key("dbmate.migration.file")
+	AttrMigrationTransaction = attribute.Key("dbmate.migration.transaction")
+	AttrMigrationRows        = attribute.Key("dbmate.migration.rows_affected")
+)
+
+// tracer returns the tracer used to create spans
+func (db *DB) tracer() trace.Tracer {
+	provider := db.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	return provider.Tracer(tracerName, trace.WithInstrumentationVersion(Version))
+}
+
+// startSpan starts a span for a dbmate action
+func (db *DB) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if db.DatabaseURL != nil {
+		attrs = append(attrs, AttrDBSystem.String(db.DatabaseURL.Scheme))
+	}
+
+	return db.tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// startMigrationSpan starts a span for applying or rolling back a single migration
+func (db *DB) startMigrationSpan(ctx context.Context, name string, migration *Migration) (context.Context, trace.Span) {
+	return db.startSpan(ctx, name,
+		AttrMigrationVersion.String(migration.Version),
+		AttrMigrationFile.String(migration.FilePath),
+	)
+}
+
+// setResultAttributes records the rows affected by a migration on its span
+func setResultAttributes(span trace.Span, result sql.Result) {
+	if result == nil {
+		return
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil {
+		span.SetAttributes(AttrMigrationRows.Int64(rowsAffected))
+	}
+}
+
+// endSpan records any error on a span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
@@ -0,0 +1,210 @@
+package dbmate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// Validation errors
+var (
+	ErrInvalidMigrationFileName = errors.New("file name must be a version number followed by an optional description and .sql extension")
+	ErrDuplicateVersion         = errors.New("duplicate migration version")
+)
+
+// CollisionPolicy specifies how migrations in different directories with the same version are handled
+type CollisionPolicy string
+
+// Collision policies
+const (
+	// CollisionError fails with an error listing the conflicting files
+	CollisionError CollisionPolicy = "error"
+	// CollisionFirst uses the migration from the directory listed first in MigrationsDir
+	CollisionFirst CollisionPolicy = "first"
+	// CollisionLast uses the migration from the directory listed last in MigrationsDir
+	CollisionLast CollisionPolicy = "last"
+)
+
+// ErrUnsupportedCollisionPolicy is returned for an unknown collision policy
+var ErrUnsupportedCollisionPolicy = errors.New("unsupported version collision policy")
+
+// ParseCollisionPolicy validates a collision policy name
+func ParseCollisionPolicy(name string) (CollisionPolicy, error) {
+	switch policy := CollisionPolicy(name); policy {
+	case CollisionError, CollisionFirst, CollisionLast:
+		return policy, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedCollisionPolicy, name)
+}
+
+// ValidationError describes a problem with a migration file
+type ValidationError struct {
+	FilePath string
+	Err      error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.FilePath, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate parses every file in MigrationsDir without connecting to the database,
+// and returns all problems found. An error is returned only if a directory cannot be read.
+func (db *DB) Validate() ([]*ValidationError, error) {
+	problems := []*ValidationError{}
+	migrations, otherDrivers := []Migration{}, []Migration{}
+	dirIndexes := []int{}
+
+	for dirIndex, dir := range db.MigrationsDir {
+		files, err := db.readMigrationsDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("%w `%s`", ErrMigrationDirNotFound, dir)
+		} else if err != nil {
+			return nil, err
+		}
+
+		dirMigrations, invalid := db.migrationsFromFiles(files)
+		for _, file := range invalid {
+			// ignore hidden files such as .gitkeep
+			if !strings.HasPrefix(file.Name, ".") {
+				problems = append(problems, &ValidationError{FilePath: file.Path, Err: ErrInvalidMigrationFileName})
+			}
+		}
+
+		for _, migration := range dirMigrations {
+			if _, err := migration.Parse(); err != nil {
+				problems = append(problems, &ValidationError{FilePath: migration.FilePath, Err: err})
+			}
+
+			// migrations for other drivers may share versions
+			if db.targetsDriver(migration) {
+				migrations = append(migrations, migration)
+				dirIndexes = append(dirIndexes, dirIndex)
+			} else {
+				otherDrivers = append(otherDrivers, migration)
+			}
+		}
+	}
+
+	conflicts, _, err := db.resolveCollisions(migrations, dirIndexes)
+	if err != nil {
+		return nil, err
+	}
+	for version, paths := range conflicts {
+		for _, path := range paths {
+			problems = append(problems, &ValidationError{
+				FilePath: path,
+				Err:      fmt.Errorf("%w `%s` (also in %s)", ErrDuplicateVersion, version, strings.Join(otherPaths(paths, path), ", ")),
+			})
+		}
+	}
+
+	readDependencies(migrations)
+	deps, _, dependencyProblems := resolveDependencies(migrations, otherDrivers)
+	problems = append(problems, dependencyProblems...)
+	if _, problem := sortDependencies(migrations, deps); problem != nil {
+		problems = append(problems, problem)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].FilePath < problems[j].FilePath
+	})
+
+	return problems, nil
+}
+
+// resolveCollisions groups migrations which share a version. Using the collision policy,
+// it returns the paths of each version which cannot be resolved, and the indexes of
+// migrations which should be skipped. dirIndexes holds the MigrationsDir index of each migration.
+// Migrations with the same version in the same directory can never be resolved.
+func (db *DB) resolveCollisions(migrations []Migration, dirIndexes []int) (map[string][]string, map[int]bool, error) {
+	policy := db.VersionCollision
+	if policy == "" {
+		policy = CollisionError
+	}
+	if _, err := ParseCollisionPolicy(string(policy)); err != nil {
+		return nil, nil, err
+	}
+
+	groups := map[string][]int{}
+	for i, migration := range migrations {
+		groups[migration.Version] = append(groups[migration.Version], i)
+	}
+
+	conflicts := map[string][]string{}
+	skip := map[int]bool{}
+	for version, indexes := range groups {
+		if len(indexes) < 2 {
+			continue
+		}
+
+		sameDir := false
+		dirs := map[int]bool{}
+		for _, i := range indexes {
+			if dirs[dirIndexes[i]] {
+				sameDir = true
+			}
+			dirs[dirIndexes[i]] = true
+		}
+
+		if policy == CollisionError || sameDir {
+			for _, i := range indexes {
+				conflicts[version] = append(conflicts[version], migrations[i].FilePath)
+			}
+			continue
+		}
+
+		// indexes are in MigrationsDir order, so keep either the first or last
+		keep := indexes[0]
+		if policy == CollisionLast {
+			keep = indexes[len(indexes)-1]
+		}
+		for _, i := range indexes {
+			if i != keep {
+				skip[i] = true
+			}
+		}
+	}
+
+	return conflicts, skip, nil
+}
+
+// logDuplicateVersions logs each migration which is not used, because the version
+// collision policy selects a migration with the same version from another directory.
+// Migration files are read by most commands, so this is only a warning when migrating.
+func (db *DB) logDuplicateVersions(ctx context.Context, level slog.Level, duplicates []Migration) {
+	for _, migration := range duplicates {
+		db.logger().Log(ctx, level, "Skipping duplicate version: "+migration.FilePath, EventKey, EventMigrationSkip, "version", migration.Version, "file", migration.FilePath)
+	}
+}
+
+// sortedKeys returns the keys of a map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// otherPaths returns paths excluding path
+func otherPaths(paths []string, path string) []string {
+	others := []string{}
+	for _, p := range paths {
+		if p != path {
+			others = append(others, p)
+		}
+	}
+
+	return others
+}
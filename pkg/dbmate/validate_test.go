@@ -0,0 +1,216 @@
+package dbmate
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log/slog"
+	"net/url"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	db := New(nil)
+	db.MigrationsDir = []string{"db/migrations", "db/other"}
+	db.FS = fstest.MapFS{
+		"db/migrations/.gitkeep": {},
+		"db/migrations/001_valid.sql": {
+			Data: []byte("-- migrate:up\ncreate table users (id int);\n-- migrate:down\ndrop table users;\n"),
+		},
+		"db/migrations/002_missing_down.sql": {
+			Data: []byte("-- migrate:up\ncreate table posts (id int);\n"),
+		},
+		"db/migrations/003_invalid_option.sql": {
+			Data: []byte("-- migrate:up timeout:soon\ncreate table comments (id int);\n-- migrate:down\n"),
+		},
+		"db/migrations/004_unknown_option.sql": {
+			Data: []byte("-- migrate:up transacton:false\ncreate table tags (id int);\n-- migrate:down\ndrop table tags;\n"),
+		},
+		"db/migrations/005_invalid_transaction.sql": {
+			Data: []byte("-- migrate:up\ncreate table likes (id int);\n-- migrate:down transaction:flase\ndrop table likes;\n"),
+		},
+		"db/migrations/README.md": {
+			Data: []byte("# migrations\n"),
+		},
+		"db/other/001_duplicate.sql": {
+			Data: []byte("-- migrate:up\n-- migrate:down\n"),
+		},
+	}
+
+	problems, err := db.Validate()
+	require.NoError(t, err)
+
+	messages := []string{}
+	for _, problem := range problems {
+		messages = append(messages, problem.Error())
+	}
+	require.Equal(t, []string{
+		"db/migrations/001_valid.sql: duplicate migration version `001` (also in db/other/001_duplicate.sql)",
+		"db/migrations/002_missing_down.sql: dbmate requires each migration to define a down block with '-- migrate:down'",
+		"db/migrations/003_invalid_option.sql: dbmate does not support the migration option `timeout:soon`",
+		"db/migrations/004_unknown_option.sql: dbmate does not support the migration option `transacton:false`",
+		"db/migrations/005_invalid_transaction.sql: dbmate does not support the migration option `transaction:flase`",
+		"db/migrations/README.md: file name must be a version number followed by an optional description and .sql extension",
+		"db/other/001_duplicate.sql: duplicate migration version `001` (also in db/migrations/001_valid.sql)",
+	}, messages)
+
+	require.ErrorIs(t, problems[0], ErrDuplicateVersion)
+	require.ErrorIs(t, problems[1], ErrParseMissingDown)
+	require.ErrorIs(t, problems[2], ErrParseInvalidOption)
+	require.ErrorIs(t, problems[3], ErrParseInvalidOption)
+	require.ErrorIs(t, problems[4], ErrParseInvalidOption)
+	require.ErrorIs(t, problems[5], ErrInvalidMigrationFileName)
+
+	// missing directory
+	db.MigrationsDir = []string{"db/missing"}
+	_, err = db.Validate()
+	require.ErrorIs(t, err, ErrMigrationDirNotFound)
+}
+
+func TestMigrationFilesCollision(t *testing.T) {
+	db := New(nil)
+	db.Log = io.Discard
+	db.MigrationsDir = []string{"db/migrations", "db/overrides"}
+	db.FS = fstest.MapFS{
+		"db/migrations/001_users.sql":    {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+		"db/migrations/002_posts.sql":    {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+		"db/overrides/001_users_dev.sql": {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+		"db/overrides/003_comments.sql":  {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+	}
+
+	paths := func(migrations []Migration) []string {
+		result := []string{}
+		for _, migration := range migrations {
+			result = append(result, migration.FilePath)
+		}
+		return result
+	}
+
+	t.Run("error", func(t *testing.T) {
+		_, err := db.migrationFiles()
+		require.ErrorIs(t, err, ErrDuplicateVersion)
+		require.EqualError(t, err, "duplicate migration version `001`: db/migrations/001_users.sql, db/overrides/001_users_dev.sql")
+	})
+
+	t.Run("first", func(t *testing.T) {
+		db.VersionCollision = CollisionFirst
+		migrations, err := db.migrationFiles()
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"db/migrations/001_users.sql",
+			"db/migrations/002_posts.sql",
+			"db/overrides/003_comments.sql",
+		}, paths(migrations))
+	})
+
+	t.Run("last", func(t *testing.T) {
+		db.VersionCollision = CollisionLast
+		migrations, err := db.migrationFiles()
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"db/overrides/001_users_dev.sql",
+			"db/migrations/002_posts.sql",
+			"db/overrides/003_comments.sql",
+		}, paths(migrations))
+	})
+
+	t.Run("warning", func(t *testing.T) {
+		output := &bytes.Buffer{}
+		db.Log = output
+		defer func() { db.Log = io.Discard }()
+
+		// reading migration files does not warn, since most commands read them
+		_, err := db.migrationFiles()
+		require.NoError(t, err)
+		require.Empty(t, output.String())
+
+		_, duplicates, err := db.readMigrationFiles()
+		require.NoError(t, err)
+		db.logDuplicateVersions(context.Background(), slog.LevelWarn, duplicates)
+		require.Equal(t, "Skipping duplicate version: db/migrations/001_users.sql\n", output.String())
+	})
+
+	t.Run("same directory", func(t *testing.T) {
+		db.VersionCollision = CollisionFirst
+		db.MigrationsDir = []string{"db/migrations"}
+		db.FS = fstest.MapFS{
+			"db/migrations/001_users.sql":  {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+			"db/migrations/001_people.sql": {Data: []byte("-- migrate:up\n-- migrate:down\n")},
+		}
+		_, err := db.migrationFiles()
+		require.EqualError(t, err, "duplicate migration version `001`: db/migrations/001_people.sql, db/migrations/001_users.sql")
+	})
+}
+
+func TestParseCollisionPolicy(t *testing.T) {
+	policy, err := ParseCollisionPolicy("last")
+	require.NoError(t, err)
+	require.Equal(t, CollisionLast, policy)
+
+	_, err = ParseCollisionPolicy("random")
+	require.ErrorIs(t, err, ErrUnsupportedCollisionPolicy)
+}
+
+func TestMigrationFilesSplit(t *testing.T) {
+	db := New(&url.URL{Scheme: "postgres"})
+	db.Log = io.Discard
+	db.FS = fstest.MapFS{
+		"db/migrations/001_users.down.sql": {Data: []byte("drop table users;\n")},
+		"db/migrations/001_users.up.sql":   {Data: []byte("create table users (id serial);\n")},
+		"db/migrations/002_posts.sql": {
+			Data: []byte("-- migrate:up\ncreate table posts (id serial);\n-- migrate:down\ndrop table posts;\n"),
+		},
+		"db/migrations/003_comments.up.sql":   {Data: []byte("create table comments (id serial);\n")},
+		"db/migrations/004_likes.down.sql":    {Data: []byte("drop table likes;\n")},
+		"db/migrations/005_tags.up.sql":       {Data: []byte("-- migrate:up transaction:false\ncreate index concurrently tags_idx on tags (name);\n")},
+		"db/migrations/005_tags.down.sql":     {Data: []byte("-- migrate:down transaction:false\ndrop index tags_idx;\ndrop table tags;\n")},
+		"db/migrations/006_ratings.down.sql":  {Data: []byte("drop table ratings;\n")},
+		"db/migrations/006_ratings.up.sql":    {Data: []byte("create table ratings (id serial);\n")},
+		"db/migrations/006_ratings_v2.up.sql": {Data: []byte("create table ratings_v2 (id serial);\n")},
+	}
+
+	t.Run("pairs", func(t *testing.T) {
+		migrations, _ := db.migrationsFromFiles([]migrationDirFile{
+			{Name: "001_users.down.sql", Path: "db/migrations/001_users.down.sql"},
+			{Name: "001_users.up.sql", Path: "db/migrations/001_users.up.sql"},
+			{Name: "002_posts.sql", Path: "db/migrations/002_posts.sql"},
+			{Name: "004_likes.down.sql", Path: "db/migrations/004_likes.down.sql"},
+		})
+		require.Equal(t, []Migration{
+			{FileName: "001_users.up.sql", FilePath: "db/migrations/001_users.up.sql", DownFilePath: "db/migrations/001_users.down.sql", FS: db.FS, Version: "001"},
+			{FileName: "002_posts.sql", FilePath: "db/migrations/002_posts.sql", FS: db.FS, Version: "002"},
+			{FileName: "004_likes.down.sql", FilePath: "db/migrations/004_likes.down.sql", DownFilePath: "db/migrations/004_likes.down.sql", FS: db.FS, Version: "004"},
+		}, migrations)
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		problems, err := db.Validate()
+		require.NoError(t, err)
+
+		messages := []string{}
+		for _, problem := range problems {
+			messages = append(messages, problem.Error())
+		}
+		require.Equal(t, []string{
+			"db/migrations/003_comments.up.sql: dbmate requires each migration to define a down block with '-- migrate:down'",
+			"db/migrations/004_likes.down.sql: dbmate requires each migration to define an up block with '-- migrate:up'",
+			"db/migrations/006_ratings.up.sql: duplicate migration version `006` (also in db/migrations/006_ratings_v2.up.sql)",
+			"db/migrations/006_ratings_v2.up.sql: dbmate requires each migration to define a down block with '-- migrate:down'",
+			"db/migrations/006_ratings_v2.up.sql: duplicate migration version `006` (also in db/migrations/006_ratings.up.sql)",
+		}, messages)
+	})
+
+	t.Run("lint", func(t *testing.T) {
+		delete(db.FS.(fstest.MapFS), "db/migrations/006_ratings_v2.up.sql")
+		issues, err := db.Lint(LintOptions{All: true, Disabled: []LintRule{LintDropTable}})
+		require.NoError(t, err)
+		require.Equal(t, []string{
+			"db/migrations/003_comments.up.sql:1: invalid-migration: dbmate requires each migration to define a down block with '-- migrate:down'",
+			"db/migrations/004_likes.down.sql:1: invalid-migration: dbmate requires each migration to define an up block with '-- migrate:up'",
+			"db/migrations/005_tags.down.sql:1: transaction-false: transaction:false is only needed for statements which cannot run in a transaction, and a failure may leave the migration partially applied",
+		}, issueStrings(issues))
+	})
+}
@@ -0,0 +1,219 @@
+package dbmate
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+)
+
+// VersionStrategy specifies how versions are chosen for new migrations
+type VersionStrategy string
+
+// Version strategies
+const (
+	// VersionTimestamp uses the current UTC time, e.g. 20151129054053
+	VersionTimestamp VersionStrategy = "timestamp"
+	// VersionSequential uses the next zero-padded number after all existing migrations, e.g. 0001
+	VersionSequential VersionStrategy = "sequential"
+)
+
+// sequentialVersionDigits is the minimum width of sequential versions
+const sequentialVersionDigits = 4
+
+// ErrUnsupportedVersionStrategy is returned for an unknown version strategy
+var ErrUnsupportedVersionStrategy = errors.New("unsupported version strategy")
+
+// ParseVersionStrategy validates a version strategy name
+func ParseVersionStrategy(name string) (VersionStrategy, error) {
+	switch strategy := VersionStrategy(name); strategy {
+	case VersionTimestamp, VersionSequential:
+		return strategy, nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedVersionStrategy, name)
+}
+
+// newMigrationVersion returns the version for a new migration
+func (db *DB) newMigrationVersion() (string, error) {
+	switch db.VersionStrategy {
+	case "", VersionTimestamp:
+		return time.Now().UTC().Format("20060102150405"), nil
+	case VersionSequential:
+		versions, err := db.existingVersions()
+		if err != nil {
+			return "", err
+		}
+		return nextSequentialVersion(versions), nil
+	}
+
+	return "", fmt.Errorf("%w: %s", ErrUnsupportedVersionStrategy, db.VersionStrategy)
+}
+
+// existingVersions returns the version of every migration file in all MigrationsDir entries,
+// including duplicates. Missing directories are ignored.
+func (db *DB) existingVersions() ([]string, error) {
+	versions := []string{}
+	for _, dir := range db.MigrationsDir {
+		files, err := db.readMigrationsDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			if matches := migrationFileRegexp.FindStringSubmatch(file.Name); len(matches) >= 2 {
+				versions = append(versions, matches[1])
+			}
+		}
+	}
+
+	return versions, nil
+}
+
+// nextSequentialVersion returns the number after the highest version, zero-padded to
+// at least the width of existing versions
+func nextSequentialVersion(versions []string) string {
+	highest := new(big.Int)
+	width := sequentialVersionDigits
+	for _, version := range versions {
+		n, ok := new(big.Int).SetString(version, 10)
+		if !ok {
+			continue
+		}
+		if n.Cmp(highest) > 0 {
+			highest = n
+		}
+		if len(version) > width {
+			width = len(version)
+		}
+	}
+
+	next := new(big.Int).Add(highest, big.NewInt(1)).String()
+	if len(next) < width {
+		next = strings.Repeat("0", width-len(next)) + next
+	}
+
+	return next
+}
+
+// compareVersions compares two versions, returning -1, 0 or 1. Numeric versions are compared
+// as numbers, so that sequential versions which outgrow their padding (such as 10000 after
+// 9999) still sort after earlier versions. Other versions are compared as text.
+func compareVersions(a, b string) int {
+	if isNumeric(a) && isNumeric(b) {
+		na, nb := trimVersion(a), trimVersion(b)
+		if len(na) != len(nb) {
+			return cmp.Compare(len(na), len(nb))
+		}
+		if c := strings.Compare(na, nb); c != 0 {
+			return c
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+// isNumeric returns true if s is a non-empty string of ASCII digits
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sortMigrations sorts migrations by version, and then by file name
+func sortMigrations(migrations []Migration) {
+	sort.SliceStable(migrations, func(i, j int) bool {
+		if c := compareVersions(migrations[i].Version, migrations[j].Version); c != 0 {
+			return c < 0
+		}
+		return migrations[i].FileName < migrations[j].FileName
+	})
+}
+
+// Renumber assigns new sequential versions to migration files, to resolve conflicts
+// such as two branches creating migrations with the same number. If no paths are
+// specified, every migration which shares its version with an earlier file (in version
+// order) is renumbered. Migrations which have already been applied should not
+// be renumbered, since they would then be applied again.
+func (db *DB) Renumber(paths ...string) error {
+	if len(paths) == 0 {
+		migrations := []Migration{}
+		for _, dir := range db.MigrationsDir {
+			files, err := db.readMigrationsDir(dir)
+			if err != nil {
+				return fmt.Errorf("%w `%s`", ErrMigrationDirNotFound, dir)
+			}
+			dirMigrations, _ := db.migrationsFromFiles(files)
+			migrations = append(migrations, dirMigrations...)
+		}
+
+		sortMigrations(migrations)
+
+		seen := map[string]bool{}
+		for _, migration := range migrations {
+			if seen[migration.Version] {
+				paths = append(paths, migration.FilePath)
+			}
+			seen[migration.Version] = true
+		}
+	}
+
+	versions, err := db.existingVersions()
+	if err != nil {
+		return err
+	}
+
+	w := db.writer()
+
+	renamed := map[string]bool{}
+	for _, path := range paths {
+		if renamed[path] {
+			continue
+		}
+
+		name := db.basePath(path)
+		matches := migrationFileRegexp.FindStringSubmatch(name)
+		if len(matches) < 2 {
+			return fmt.Errorf("%w: %s", ErrInvalidMigrationFileName, path)
+		}
+
+		// the up and down files of a split migration are renumbered together
+		files := []string{path}
+		if split := splitMigrationRegExp.FindStringSubmatch(path); split != nil {
+			for _, suffix := range []string{".up.sql", ".down.sql"} {
+				sibling := split[1] + suffix
+				if _, err := db.stat(sibling); sibling != path && err == nil {
+					files = append(files, sibling)
+				}
+			}
+		}
+
+		version := nextSequentialVersion(versions)
+		versions = append(versions, version)
+
+		for _, file := range files {
+			newPath := db.joinPath(db.dirPath(file), version+strings.TrimPrefix(db.basePath(file), matches[1]))
+			db.logger().Info(fmt.Sprintf("Renaming: %s -> %s", file, newPath),
+				EventKey, EventMigrationRenumber, "file", file, "new_file", newPath)
+			if err := w.Rename(file, newPath); err != nil {
+				return err
+			}
+			renamed[file] = true
+		}
+	}
+
+	return nil
+}
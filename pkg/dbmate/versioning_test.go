@@ -0,0 +1,153 @@
+package dbmate
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextSequentialVersion(t *testing.T) {
+	require.Equal(t, "0001", nextSequentialVersion(nil))
+	require.Equal(t, "0003", nextSequentialVersion([]string{"0001", "0002"}))
+	require.Equal(t, "0011", nextSequentialVersion([]string{"0010", "0002"}))
+	require.Equal(t, "000008", nextSequentialVersion([]string{"000007"}))
+	require.Equal(t, "10000", nextSequentialVersion([]string{"9999"}))
+	require.Equal(t, "20151129054054", nextSequentialVersion([]string{"0001", "20151129054053"}))
+}
+
+func TestParseVersionStrategy(t *testing.T) {
+	strategy, err := ParseVersionStrategy("sequential")
+	require.NoError(t, err)
+	require.Equal(t, VersionSequential, strategy)
+
+	_, err = ParseVersionStrategy("random")
+	require.ErrorIs(t, err, ErrUnsupportedVersionStrategy)
+}
+
+func writeMigrationFiles(t *testing.T, dir string, names ...string) {
+	require.NoError(t, os.MkdirAll(dir, 0o755))
+	for _, name := range names {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("-- migrate:up\n-- migrate:down\n"), 0o644))
+	}
+}
+
+func listMigrationFiles(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+
+	return names
+}
+
+func TestNewMigrationSequential(t *testing.T) {
+	dir := t.TempDir()
+	db := New(nil)
+	db.Log = io.Discard
+	db.VersionStrategy = VersionSequential
+	db.MigrationsDir = []string{filepath.Join(dir, "one"), filepath.Join(dir, "two")}
+
+	// first migration, directories are created as needed
+	require.NoError(t, db.NewMigration("create_users"))
+	require.Equal(t, []string{"0001_create_users.sql"}, listMigrationFiles(t, db.MigrationsDir[0]))
+
+	// next number is computed across all directories
+	writeMigrationFiles(t, db.MigrationsDir[1], "0007_create_posts.sql")
+	require.NoError(t, db.NewMigration("create_comments"))
+	require.Equal(t, []string{
+		"0001_create_users.sql",
+		"0008_create_comments.sql",
+	}, listMigrationFiles(t, db.MigrationsDir[0]))
+}
+
+func TestRenumber(t *testing.T) {
+	t.Run("conflicts", func(t *testing.T) {
+		dir := t.TempDir()
+		db := New(nil)
+		db.Log = io.Discard
+		db.MigrationsDir = []string{dir}
+		writeMigrationFiles(t, dir,
+			"0001_create_users.sql",
+			"0002_create_posts.sql",
+			"0002_add_email.sql",
+			"0003_create_comments.sql",
+			"0003_create_likes.sql",
+		)
+
+		require.NoError(t, db.Renumber())
+		require.Equal(t, []string{
+			"0001_create_users.sql",
+			"0002_add_email.sql",
+			"0003_create_comments.sql",
+			"0004_create_posts.sql",
+			"0005_create_likes.sql",
+		}, listMigrationFiles(t, dir))
+	})
+
+	t.Run("paths", func(t *testing.T) {
+		dir := t.TempDir()
+		db := New(nil)
+		db.Log = io.Discard
+		db.MigrationsDir = []string{dir}
+		writeMigrationFiles(t, dir,
+			"0001_create_users.sql",
+			"0002_create_posts.sql",
+			"0002_add_email.sql",
+		)
+
+		require.NoError(t, db.Renumber(filepath.Join(dir, "0002_create_posts.sql")))
+		require.Equal(t, []string{
+			"0001_create_users.sql",
+			"0002_add_email.sql",
+			"0003_create_posts.sql",
+		}, listMigrationFiles(t, dir))
+
+		err := db.Renumber(filepath.Join(dir, "notes.txt"))
+		require.ErrorIs(t, err, ErrInvalidMigrationFileName)
+	})
+
+	t.Run("split", func(t *testing.T) {
+		dir := t.TempDir()
+		db := New(nil)
+		db.Log = io.Discard
+		db.MigrationsDir = []string{dir}
+		writeMigrationFiles(t, dir,
+			"0001_create_users.down.sql",
+			"0001_create_users.up.sql",
+			"0001_create_posts.down.sql",
+			"0001_create_posts.up.sql",
+		)
+
+		// both files of a split migration are renamed together
+		require.NoError(t, db.Renumber())
+		require.Equal(t, []string{
+			"0001_create_posts.down.sql",
+			"0001_create_posts.up.sql",
+			"0002_create_users.down.sql",
+			"0002_create_users.up.sql",
+		}, listMigrationFiles(t, dir))
+	})
+}
+
+func TestCompareVersions(t *testing.T) {
+	require.Equal(t, -1, compareVersions("9999", "10000"))
+	require.Equal(t, 1, compareVersions("10000", "9999"))
+	require.Equal(t, -1, compareVersions("0002", "10"))
+	require.Equal(t, 0, compareVersions("0001", "0001"))
+	require.Equal(t, -1, compareVersions("001", "1"))
+	require.Equal(t, -1, compareVersions("20151129054053", "20151129054054"))
+	require.Equal(t, -1, compareVersions("abc", "abd"))
+
+	migrations := []Migration{
+		{Version: "10000", FileName: "10000_b.sql"},
+		{Version: "9999", FileName: "9999_a.sql"},
+	}
+	sortMigrations(migrations)
+	require.Equal(t, "9999", migrations[0].Version)
+}
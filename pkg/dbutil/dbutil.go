@@ -3,6 +3,7 @@ package dbutil
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"database/sql"
 	"errors"
 	"io"
@@ -19,6 +20,65 @@ type Transaction interface {
 	QueryRow(query string, args ...interface{}) *sql.Row
 }
 
+// ContextTransaction is a Transaction whose statements can be canceled with a context,
+// such as *sql.DB, *sql.Tx or Conn
+type ContextTransaction interface {
+	Transaction
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Conn adapts a dedicated connection, which only has context-aware methods, to a Transaction
+type Conn struct {
+	*sql.Conn
+}
+
+// Exec executes a statement on the connection
+func (c Conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.ExecContext(context.Background(), query, args...)
+}
+
+// Query runs a query on the connection
+func (c Conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.QueryContext(context.Background(), query, args...)
+}
+
+// QueryRow runs a query on the connection which returns at most one row
+func (c Conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.QueryRowContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a statement, which is canceled with the context if db is a
+// ContextTransaction
+func ExecContext(ctx context.Context, db Transaction, query string, args ...interface{}) (sql.Result, error) {
+	if ctxDB, ok := db.(ContextTransaction); ok {
+		return ctxDB.ExecContext(ctx, query, args...)
+	}
+
+	return db.Exec(query, args...)
+}
+
+// QueryContext runs a query, which is canceled with the context if db is a
+// ContextTransaction
+func QueryContext(ctx context.Context, db Transaction, query string, args ...interface{}) (*sql.Rows, error) {
+	if ctxDB, ok := db.(ContextTransaction); ok {
+		return ctxDB.QueryContext(ctx, query, args...)
+	}
+
+	return db.Query(query, args...)
+}
+
+// QueryRowContext runs a query which returns at most one row, which is canceled with
+// the context if db is a ContextTransaction
+func QueryRowContext(ctx context.Context, db Transaction, query string, args ...interface{}) *sql.Row {
+	if ctxDB, ok := db.(ContextTransaction); ok {
+		return ctxDB.QueryRowContext(ctx, query, args...)
+	}
+
+	return db.QueryRow(query, args...)
+}
+
 // DatabaseName returns the database name from a URL
 func DatabaseName(u *url.URL) string {
 	name := u.Path
@@ -38,8 +98,14 @@ func MustClose(c io.Closer) {
 
 // RunCommand runs a command and returns the stdout if successful
 func RunCommand(name string, args ...string) ([]byte, error) {
+	return RunCommandContext(context.Background(), name, args...)
+}
+
+// RunCommandContext runs a command and returns the stdout if successful
+// The command is killed if the context is canceled before it completes.
+func RunCommandContext(ctx context.Context, name string, args ...string) ([]byte, error) {
 	var stdout, stderr bytes.Buffer
-	cmd := exec.Command(name, args...)
+	cmd := exec.CommandContext(ctx, name, args...)
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
 
@@ -101,7 +167,13 @@ func TrimLeadingSQLComments(data []byte) ([]byte, error) {
 // it is assumed that the statement returns only one column
 // e.g. schema_migrations table
 func QueryColumn(db Transaction, query string, args ...interface{}) ([]string, error) {
-	rows, err := db.Query(query, args...)
+	return QueryColumnContext(context.Background(), db, query, args...)
+}
+
+// QueryColumnContext runs a SQL statement and returns a slice of strings,
+// stopping if the context is canceled
+func QueryColumnContext(ctx context.Context, db Transaction, query string, args ...interface{}) ([]string, error) {
+	rows, err := QueryContext(ctx, db, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -128,8 +200,14 @@ func QueryColumn(db Transaction, query string, args ...interface{}) ([]string, e
 // it is assumed that the statement returns only one row and one column
 // sql NULL is returned as empty string
 func QueryValue(db Transaction, query string, args ...interface{}) (string, error) {
+	return QueryValueContext(context.Background(), db, query, args...)
+}
+
+// QueryValueContext runs a SQL statement and returns a single string,
+// stopping if the context is canceled
+func QueryValueContext(ctx context.Context, db Transaction, query string, args ...interface{}) (string, error) {
 	var result sql.NullString
-	err := db.QueryRow(query, args...).Scan(&result)
+	err := QueryRowContext(ctx, db, query, args...).Scan(&result)
 	if err != nil || !result.Valid {
 		return "", err
 	}
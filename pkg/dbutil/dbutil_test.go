@@ -1,6 +1,7 @@
 package dbutil_test
 
 import (
+	"context"
 	"database/sql"
 	"testing"
 
@@ -56,3 +57,47 @@ func TestQueryValue(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "7", val)
 }
+
+func TestQueryValueContext(t *testing.T) {
+	db, err := sql.Open("sqlite3", sqliteMemoryDB)
+	require.NoError(t, err)
+
+	val, err := dbutil.QueryValueContext(context.Background(), db, "select $1 + $2", "5", 2)
+	require.NoError(t, err)
+	require.Equal(t, "7", val)
+
+	// canceled contexts stop the query
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dbutil.QueryValueContext(ctx, db, "select 1")
+	require.ErrorIs(t, err, context.Canceled)
+}
+
+func TestQueryValueContextTransaction(t *testing.T) {
+	db, err := sql.Open("sqlite3", sqliteMemoryDB)
+	require.NoError(t, err)
+
+	// transactions without context-aware methods ignore the context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	val, err := dbutil.QueryValueContext(ctx, struct{ dbutil.Transaction }{db}, "select 1")
+	require.NoError(t, err)
+	require.Equal(t, "1", val)
+}
+
+func TestConn(t *testing.T) {
+	db, err := sql.Open("sqlite3", sqliteMemoryDB)
+	require.NoError(t, err)
+
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer dbutil.MustClose(conn)
+
+	var tx dbutil.Transaction = dbutil.Conn{Conn: conn}
+	_, ok := tx.(dbutil.ContextTransaction)
+	require.True(t, ok)
+
+	val, err := dbutil.QueryValue(tx, "select $1 + $2", "5", 2)
+	require.NoError(t, err)
+	require.Equal(t, "7", val)
+}
@@ -2,13 +2,15 @@ package clickhouse
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/url"
 	"regexp"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
@@ -24,7 +26,7 @@ func init() {
 type Driver struct {
 	migrationsTableName string
 	databaseURL         *url.URL
-	log                 io.Writer
+	logger              *slog.Logger
 	clusterParameters   *ClusterParameters
 }
 
@@ -33,7 +35,7 @@ func NewDriver(config dbmate.DriverConfig) dbmate.Driver {
 	return &Driver{
 		migrationsTableName: config.MigrationsTableName,
 		databaseURL:         config.DatabaseURL,
-		log:                 config.Log,
+		logger:              config.GetLogger(),
 		clusterParameters:   ExtractClusterParametersFromURL(config.DatabaseURL),
 	}
 }
@@ -136,8 +138,13 @@ func (drv *Driver) escapeString(str string) string {
 
 // CreateDatabase creates the specified database
 func (drv *Driver) CreateDatabase() error {
+	return drv.CreateDatabaseContext(context.Background())
+}
+
+// CreateDatabaseContext creates the specified database
+func (drv *Driver) CreateDatabaseContext(ctx context.Context) error {
 	name := drv.databaseName()
-	fmt.Fprintf(drv.log, "Creating: %s\n", name)
+	drv.logger.Info("Creating: "+name, dbmate.EventKey, dbmate.EventDatabaseCreate, "database", name)
 
 	db, err := drv.openClickHouseDB()
 	if err != nil {
@@ -147,15 +154,20 @@ func (drv *Driver) CreateDatabase() error {
 
 	q := fmt.Sprintf("CREATE DATABASE %s%s", drv.quoteIdentifier(name), drv.onClusterClause())
 
-	_, err = db.Exec(q)
+	_, err = db.ExecContext(ctx, q)
 
 	return err
 }
 
 // DropDatabase drops the specified database (if it exists)
 func (drv *Driver) DropDatabase() error {
+	return drv.DropDatabaseContext(context.Background())
+}
+
+// DropDatabaseContext drops the specified database (if it exists)
+func (drv *Driver) DropDatabaseContext(ctx context.Context) error {
 	name := drv.databaseName()
-	fmt.Fprintf(drv.log, "Dropping: %s\n", name)
+	drv.logger.Info("Dropping: "+name, dbmate.EventKey, dbmate.EventDatabaseDrop, "database", name)
 
 	db, err := drv.openClickHouseDB()
 	if err != nil {
@@ -165,16 +177,16 @@ func (drv *Driver) DropDatabase() error {
 
 	q := fmt.Sprintf("DROP DATABASE IF EXISTS %s%s", drv.quoteIdentifier(name), drv.onClusterClause())
 
-	_, err = db.Exec(q)
+	_, err = db.ExecContext(ctx, q)
 
 	return err
 }
 
-func (drv *Driver) schemaDump(db *sql.DB, buf *bytes.Buffer, databaseName string) error {
+func (drv *Driver) schemaDump(ctx context.Context, db *sql.DB, buf *bytes.Buffer, databaseName string) error {
 	buf.WriteString("\n--\n-- Database schema\n--\n\n")
 	buf.WriteString(fmt.Sprintf("CREATE DATABASE IF NOT EXISTS %s%s;\n\n", drv.quoteIdentifier(databaseName), drv.onClusterClause()))
 
-	tables, err := dbutil.QueryColumn(db, "show tables")
+	tables, err := dbutil.QueryColumnContext(ctx, db, "show tables")
 	if err != nil {
 		return err
 	}
@@ -182,7 +194,7 @@ func (drv *Driver) schemaDump(db *sql.DB, buf *bytes.Buffer, databaseName string
 
 	for _, table := range tables {
 		var clause string
-		err = db.QueryRow("show create table " + drv.quoteIdentifier(table)).Scan(&clause)
+		err = db.QueryRowContext(ctx, "show create table "+drv.quoteIdentifier(table)).Scan(&clause)
 		if err != nil {
 			return err
 		}
@@ -191,11 +203,11 @@ func (drv *Driver) schemaDump(db *sql.DB, buf *bytes.Buffer, databaseName string
 	return nil
 }
 
-func (drv *Driver) schemaMigrationsDump(db *sql.DB, buf *bytes.Buffer) error {
+func (drv *Driver) schemaMigrationsDump(ctx context.Context, db *sql.DB, buf *bytes.Buffer) error {
 	migrationsTable := drv.quotedMigrationsTableName()
 
 	// load applied migrations
-	migrations, err := dbutil.QueryColumn(db,
+	migrations, err := dbutil.QueryColumnContext(ctx, db,
 		fmt.Sprintf("select version from %s final ", migrationsTable)+
 			"where applied order by version asc",
 	)
@@ -223,15 +235,20 @@ func (drv *Driver) schemaMigrationsDump(db *sql.DB, buf *bytes.Buffer) error {
 
 // DumpSchema returns the current database schema
 func (drv *Driver) DumpSchema(db *sql.DB) ([]byte, error) {
+	return drv.DumpSchemaContext(context.Background(), db)
+}
+
+// DumpSchemaContext returns the current database schema
+func (drv *Driver) DumpSchemaContext(ctx context.Context, db *sql.DB) ([]byte, error) {
 	var buf bytes.Buffer
 	var err error
 
-	err = drv.schemaDump(db, &buf, drv.databaseName())
+	err = drv.schemaDump(ctx, db, &buf, drv.databaseName())
 	if err != nil {
 		return nil, err
 	}
 
-	err = drv.schemaMigrationsDump(db, &buf)
+	err = drv.schemaMigrationsDump(ctx, db, &buf)
 	if err != nil {
 		return nil, err
 	}
@@ -241,6 +258,11 @@ func (drv *Driver) DumpSchema(db *sql.DB) ([]byte, error) {
 
 // DatabaseExists determines whether the database exists
 func (drv *Driver) DatabaseExists() (bool, error) {
+	return drv.DatabaseExistsContext(context.Background())
+}
+
+// DatabaseExistsContext determines whether the database exists
+func (drv *Driver) DatabaseExistsContext(ctx context.Context) (bool, error) {
 	name := drv.databaseName()
 
 	db, err := drv.openClickHouseDB()
@@ -250,7 +272,7 @@ func (drv *Driver) DatabaseExists() (bool, error) {
 	defer dbutil.MustClose(db)
 
 	exists := false
-	err = db.QueryRow("SELECT 1 FROM system.databases where name = ?", name).
+	err = db.QueryRowContext(ctx, "SELECT 1 FROM system.databases where name = ?", name).
 		Scan(&exists)
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -261,8 +283,13 @@ func (drv *Driver) DatabaseExists() (bool, error) {
 
 // MigrationsTableExists checks if the schema_migrations table exists
 func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.MigrationsTableExistsContext(context.Background(), db)
+}
+
+// MigrationsTableExistsContext checks if the schema_migrations table exists
+func (drv *Driver) MigrationsTableExistsContext(ctx context.Context, db *sql.DB) (bool, error) {
 	exists := false
-	err := db.QueryRow(fmt.Sprintf("EXISTS TABLE %s", drv.quotedMigrationsTableName())).
+	err := db.QueryRowContext(ctx, fmt.Sprintf("EXISTS TABLE %s", drv.quotedMigrationsTableName())).
 		Scan(&exists)
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -273,6 +300,11 @@ func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
 
 // CreateMigrationsTable creates the schema migrations table
 func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
+	return drv.CreateMigrationsTableContext(context.Background(), db)
+}
+
+// CreateMigrationsTableContext creates the schema migrations table
+func (drv *Driver) CreateMigrationsTableContext(ctx context.Context, db *sql.DB) error {
 	engineClause := "ReplacingMergeTree(ts)"
 	if drv.clusterParameters.OnCluster {
 		escapedZooPath := drv.escapeString(drv.clusterParameters.ZooPath)
@@ -280,7 +312,7 @@ func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
 		engineClause = fmt.Sprintf("ReplicatedReplacingMergeTree('%s', '%s', ts)", escapedZooPath, escapedReplicaMacro)
 	}
 
-	_, err := db.Exec(fmt.Sprintf(`
+	_, err := db.ExecContext(ctx, fmt.Sprintf(`
 		create table if not exists %s%s (
 			version String,
 			ts DateTime default now(),
@@ -296,13 +328,19 @@ func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
 // SelectMigrations returns a list of applied migrations
 // with an optional limit (in descending order)
 func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.SelectMigrationsContext(context.Background(), db, limit)
+}
+
+// SelectMigrationsContext returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv *Driver) SelectMigrationsContext(ctx context.Context, db *sql.DB, limit int) (map[string]bool, error) {
 	query := fmt.Sprintf("select version from %s final where applied order by version desc",
 		drv.quotedMigrationsTableName())
 
 	if limit >= 0 {
 		query = fmt.Sprintf("%s limit %d", query, limit)
 	}
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -328,7 +366,12 @@ func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, err
 
 // InsertMigration adds a new migration record
 func (drv *Driver) InsertMigration(db dbutil.Transaction, version string) error {
-	_, err := db.Exec(
+	return drv.InsertMigrationContext(context.Background(), db, version)
+}
+
+// InsertMigrationContext adds a new migration record
+func (drv *Driver) InsertMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	_, err := dbutil.ExecContext(ctx, db,
 		fmt.Sprintf("insert into %s (version) values (?)", drv.quotedMigrationsTableName()),
 		version)
 
@@ -337,7 +380,12 @@ func (drv *Driver) InsertMigration(db dbutil.Transaction, version string) error
 
 // DeleteMigration removes a migration record
 func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error {
-	_, err := db.Exec(
+	return drv.DeleteMigrationContext(context.Background(), db, version)
+}
+
+// DeleteMigrationContext removes a migration record
+func (drv *Driver) DeleteMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	_, err := dbutil.ExecContext(ctx, db,
 		fmt.Sprintf("insert into %s (version, applied) values (?, ?)",
 			drv.quotedMigrationsTableName()),
 		version, false,
@@ -349,13 +397,19 @@ func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error
 // Ping verifies a connection to the database server. It does not verify whether the
 // specified database exists.
 func (drv *Driver) Ping() error {
+	return drv.PingContext(context.Background())
+}
+
+// PingContext verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv *Driver) PingContext(ctx context.Context) error {
 	db, err := drv.Open()
 	if err != nil {
 		return err
 	}
 	defer dbutil.MustClose(db)
 
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err == nil {
 		return nil
 	}
@@ -371,9 +425,28 @@ func (drv *Driver) Ping() error {
 
 // Return a normalized version of the driver-specific error type.
 func (drv *Driver) QueryError(query string, err error) error {
+	if chErr, ok := err.(*clickhouse.Exception); ok && chErr.Code == 159 { // TIMEOUT_EXCEEDED
+		err = fmt.Errorf("%w: %w", dbmate.ErrStatementTimeout, err)
+	}
+
 	return &dbmate.QueryError{Err: err, Query: query}
 }
 
+// SetTimeouts applies the statement timeout as max_execution_time for the current
+// session. ClickHouse does not take table locks, so lockTimeout is ignored.
+// A zero duration restores the server default.
+func (drv *Driver) SetTimeouts(ctx context.Context, db dbutil.Transaction, statementTimeout, _ time.Duration) error {
+	maxExecutionTime := "DEFAULT"
+	if statementTimeout > 0 {
+		// seconds, rounded up (setting 0 would mean unlimited)
+		maxExecutionTime = fmt.Sprint(int64((statementTimeout + time.Second - 1) / time.Second))
+	}
+
+	_, err := dbutil.ExecContext(ctx, db, "SET max_execution_time = "+maxExecutionTime)
+
+	return err
+}
+
 func (drv *Driver) quotedMigrationsTableName() string {
 	return drv.quoteIdentifier(drv.migrationsTableName)
 }
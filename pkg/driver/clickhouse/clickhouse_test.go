@@ -1,9 +1,12 @@
 package clickhouse
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
@@ -21,6 +24,9 @@ func TestGetDriver(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, db.DatabaseURL.String(), drv.databaseURL.String())
 	require.Equal(t, "schema_migrations", drv.migrationsTableName)
+
+	// driver operations can be canceled with a context
+	require.Implements(t, (*dbmate.ContextDriver)(nil), drv)
 }
 
 func TestConnectionString(t *testing.T) {
@@ -414,3 +420,39 @@ func TestEscapeString(t *testing.T) {
 		})
 	}
 }
+
+func TestClickHouseSetTimeouts(t *testing.T) {
+	drv := testClickHouseDriver(t)
+	db := prepTestClickHouseDB(t, drv)
+	defer dbutil.MustClose(db)
+
+	sqlConn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer dbutil.MustClose(sqlConn)
+	conn := dbutil.Conn{Conn: sqlConn}
+
+	err = drv.SetTimeouts(context.Background(), conn, 1500*time.Millisecond, 0)
+	require.NoError(t, err)
+
+	value, err := dbutil.QueryValueContext(context.Background(), conn,
+		"select value from system.settings where name = 'max_execution_time'")
+	require.NoError(t, err)
+	require.Equal(t, "2", value)
+
+	// exceeding the statement timeout returns a clear error
+	query := "select count() from numbers(1000000000000)"
+	_, err = conn.ExecContext(context.Background(), query)
+	require.Error(t, err)
+	err = drv.QueryError(query, err)
+	require.True(t, errors.Is(err, dbmate.ErrStatementTimeout))
+	require.Contains(t, err.Error(), "statement timeout exceeded: code: 159")
+
+	// zero restores the server default rather than removing the limit
+	err = drv.SetTimeouts(context.Background(), conn, 0, 0)
+	require.NoError(t, err)
+
+	value, err = dbutil.QueryValueContext(context.Background(), conn,
+		"select toString(changed) from system.settings where name = 'max_execution_time'")
+	require.NoError(t, err)
+	require.Equal(t, "0", value)
+}
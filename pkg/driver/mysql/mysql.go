@@ -2,17 +2,19 @@ package mysql
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/url"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
 
-	_ "github.com/go-sql-driver/mysql" // database/sql driver
+	"github.com/go-sql-driver/mysql"
 )
 
 func init() {
@@ -23,7 +25,7 @@ func init() {
 type Driver struct {
 	migrationsTableName string
 	databaseURL         *url.URL
-	log                 io.Writer
+	logger              *slog.Logger
 }
 
 // NewDriver initializes the driver
@@ -31,7 +33,7 @@ func NewDriver(config dbmate.DriverConfig) dbmate.Driver {
 	return &Driver{
 		migrationsTableName: config.MigrationsTableName,
 		databaseURL:         config.DatabaseURL,
-		log:                 config.Log,
+		logger:              config.GetLogger(),
 	}
 }
 
@@ -95,8 +97,13 @@ func (drv *Driver) quoteIdentifier(str string) string {
 
 // CreateDatabase creates the specified database
 func (drv *Driver) CreateDatabase() error {
+	return drv.CreateDatabaseContext(context.Background())
+}
+
+// CreateDatabaseContext creates the specified database
+func (drv *Driver) CreateDatabaseContext(ctx context.Context) error {
 	name := dbutil.DatabaseName(drv.databaseURL)
-	fmt.Fprintf(drv.log, "Creating: %s\n", name)
+	drv.logger.Info("Creating: "+name, dbmate.EventKey, dbmate.EventDatabaseCreate, "database", name)
 
 	db, err := drv.openRootDB()
 	if err != nil {
@@ -104,7 +111,7 @@ func (drv *Driver) CreateDatabase() error {
 	}
 	defer dbutil.MustClose(db)
 
-	_, err = db.Exec(fmt.Sprintf("create database %s",
+	_, err = db.ExecContext(ctx, fmt.Sprintf("create database %s",
 		drv.quoteIdentifier(name)))
 
 	return err
@@ -112,8 +119,13 @@ func (drv *Driver) CreateDatabase() error {
 
 // DropDatabase drops the specified database (if it exists)
 func (drv *Driver) DropDatabase() error {
+	return drv.DropDatabaseContext(context.Background())
+}
+
+// DropDatabaseContext drops the specified database (if it exists)
+func (drv *Driver) DropDatabaseContext(ctx context.Context) error {
 	name := dbutil.DatabaseName(drv.databaseURL)
-	fmt.Fprintf(drv.log, "Dropping: %s\n", name)
+	drv.logger.Info("Dropping: "+name, dbmate.EventKey, dbmate.EventDatabaseDrop, "database", name)
 
 	db, err := drv.openRootDB()
 	if err != nil {
@@ -121,7 +133,7 @@ func (drv *Driver) DropDatabase() error {
 	}
 	defer dbutil.MustClose(db)
 
-	_, err = db.Exec(fmt.Sprintf("drop database if exists %s",
+	_, err = db.ExecContext(ctx, fmt.Sprintf("drop database if exists %s",
 		drv.quoteIdentifier(name)))
 
 	return err
@@ -157,11 +169,11 @@ func (drv *Driver) mysqldumpArgs() []string {
 	return args
 }
 
-func (drv *Driver) schemaMigrationsDump(db *sql.DB) ([]byte, error) {
+func (drv *Driver) schemaMigrationsDump(ctx context.Context, db *sql.DB) ([]byte, error) {
 	migrationsTable := drv.quotedMigrationsTableName()
 
 	// load applied migrations
-	migrations, err := dbutil.QueryColumn(db,
+	migrations, err := dbutil.QueryColumnContext(ctx, db,
 		fmt.Sprintf("select quote(version) from %s order by version asc", migrationsTable))
 	if err != nil {
 		return nil, err
@@ -186,12 +198,17 @@ func (drv *Driver) schemaMigrationsDump(db *sql.DB) ([]byte, error) {
 
 // DumpSchema returns the current database schema
 func (drv *Driver) DumpSchema(db *sql.DB) ([]byte, error) {
-	schema, err := dbutil.RunCommand("mysqldump", drv.mysqldumpArgs()...)
+	return drv.DumpSchemaContext(context.Background(), db)
+}
+
+// DumpSchemaContext returns the current database schema
+func (drv *Driver) DumpSchemaContext(ctx context.Context, db *sql.DB) ([]byte, error) {
+	schema, err := dbutil.RunCommandContext(ctx, "mysqldump", drv.mysqldumpArgs()...)
 	if err != nil {
 		return nil, err
 	}
 
-	migrations, err := drv.schemaMigrationsDump(db)
+	migrations, err := drv.schemaMigrationsDump(ctx, db)
 	if err != nil {
 		return nil, err
 	}
@@ -212,6 +229,11 @@ func trimAutoincrementValues(data []byte) []byte {
 
 // DatabaseExists determines whether the database exists
 func (drv *Driver) DatabaseExists() (bool, error) {
+	return drv.DatabaseExistsContext(context.Background())
+}
+
+// DatabaseExistsContext determines whether the database exists
+func (drv *Driver) DatabaseExistsContext(ctx context.Context) (bool, error) {
 	name := dbutil.DatabaseName(drv.databaseURL)
 
 	db, err := drv.openRootDB()
@@ -221,7 +243,7 @@ func (drv *Driver) DatabaseExists() (bool, error) {
 	defer dbutil.MustClose(db)
 
 	exists := false
-	err = db.QueryRow("select true from information_schema.schemata "+
+	err = db.QueryRowContext(ctx, "select true from information_schema.schemata "+
 		"where schema_name = ?", name).Scan(&exists)
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -232,8 +254,13 @@ func (drv *Driver) DatabaseExists() (bool, error) {
 
 // MigrationsTableExists checks if the schema_migrations table exists
 func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.MigrationsTableExistsContext(context.Background(), db)
+}
+
+// MigrationsTableExistsContext checks if the schema_migrations table exists
+func (drv *Driver) MigrationsTableExistsContext(ctx context.Context, db *sql.DB) (bool, error) {
 	match := ""
-	err := db.QueryRow(fmt.Sprintf("show tables like '%s'",
+	err := db.QueryRowContext(ctx, fmt.Sprintf("show tables like '%s'",
 		drv.migrationsTableName)).
 		Scan(&match)
 	if err == sql.ErrNoRows {
@@ -245,7 +272,12 @@ func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
 
 // CreateMigrationsTable creates the schema_migrations table
 func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec(fmt.Sprintf(
+	return drv.CreateMigrationsTableContext(context.Background(), db)
+}
+
+// CreateMigrationsTableContext creates the schema_migrations table
+func (drv *Driver) CreateMigrationsTableContext(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
 		"create table if not exists %s (version varchar(128) primary key)",
 		drv.quotedMigrationsTableName()))
 
@@ -255,11 +287,17 @@ func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
 // SelectMigrations returns a list of applied migrations
 // with an optional limit (in descending order)
 func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.SelectMigrationsContext(context.Background(), db, limit)
+}
+
+// SelectMigrationsContext returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv *Driver) SelectMigrationsContext(ctx context.Context, db *sql.DB, limit int) (map[string]bool, error) {
 	query := fmt.Sprintf("select version from %s order by version desc", drv.quotedMigrationsTableName())
 	if limit >= 0 {
 		query = fmt.Sprintf("%s limit %d", query, limit)
 	}
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -285,7 +323,12 @@ func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, err
 
 // InsertMigration adds a new migration record
 func (drv *Driver) InsertMigration(db dbutil.Transaction, version string) error {
-	_, err := db.Exec(
+	return drv.InsertMigrationContext(context.Background(), db, version)
+}
+
+// InsertMigrationContext adds a new migration record
+func (drv *Driver) InsertMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	_, err := dbutil.ExecContext(ctx, db,
 		fmt.Sprintf("insert into %s (version) values (?)", drv.quotedMigrationsTableName()),
 		version)
 
@@ -294,7 +337,12 @@ func (drv *Driver) InsertMigration(db dbutil.Transaction, version string) error
 
 // DeleteMigration removes a migration record
 func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error {
-	_, err := db.Exec(
+	return drv.DeleteMigrationContext(context.Background(), db, version)
+}
+
+// DeleteMigrationContext removes a migration record
+func (drv *Driver) DeleteMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	_, err := dbutil.ExecContext(ctx, db,
 		fmt.Sprintf("delete from %s where version = ?", drv.quotedMigrationsTableName()),
 		version)
 
@@ -304,20 +352,60 @@ func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error
 // Ping verifies a connection to the database server. It does not verify whether the
 // specified database exists.
 func (drv *Driver) Ping() error {
+	return drv.PingContext(context.Background())
+}
+
+// PingContext verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv *Driver) PingContext(ctx context.Context) error {
 	db, err := drv.openRootDB()
 	if err != nil {
 		return err
 	}
 	defer dbutil.MustClose(db)
 
-	return db.Ping()
+	return db.PingContext(ctx)
 }
 
 // Return a normalized version of the driver-specific error type.
 func (drv *Driver) QueryError(query string, err error) error {
+	if myErr, ok := err.(*mysql.MySQLError); ok {
+		switch myErr.Number {
+		case 3024: // ER_QUERY_TIMEOUT
+			err = fmt.Errorf("%w: %w", dbmate.ErrStatementTimeout, err)
+		case 1205: // ER_LOCK_WAIT_TIMEOUT
+			err = fmt.Errorf("%w: %w", dbmate.ErrLockTimeout, err)
+		}
+	}
+
 	return &dbmate.QueryError{Err: err, Query: query}
 }
 
+// SetTimeouts applies statement and lock timeouts to the current session.
+// MySQL only enforces max_execution_time for read-only SELECT statements, so a
+// statement timeout does not limit DDL or DML, and a warning is logged.
+// A zero duration restores the server default.
+func (drv *Driver) SetTimeouts(ctx context.Context, db dbutil.Transaction, statementTimeout, lockTimeout time.Duration) error {
+	maxExecutionTime := "DEFAULT"
+	if statementTimeout > 0 {
+		drv.logger.Warn(fmt.Sprintf("MySQL only applies the statement timeout (%s) to SELECT statements", statementTimeout),
+			"timeout", statementTimeout.String())
+		// milliseconds, rounded up
+		maxExecutionTime = fmt.Sprint(int64((statementTimeout + time.Millisecond - 1) / time.Millisecond))
+	}
+
+	lockWaitTimeout := "DEFAULT"
+	if lockTimeout > 0 {
+		// seconds, rounded up
+		lockWaitTimeout = fmt.Sprint(int64((lockTimeout + time.Second - 1) / time.Second))
+	}
+
+	_, err := dbutil.ExecContext(ctx, db, fmt.Sprintf("SET SESSION max_execution_time = %s, SESSION lock_wait_timeout = %s",
+		maxExecutionTime, lockWaitTimeout))
+
+	return err
+}
+
 func (drv *Driver) quotedMigrationsTableName() string {
 	return drv.quoteIdentifier(drv.migrationsTableName)
 }
@@ -1,10 +1,13 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
@@ -48,6 +51,9 @@ func TestGetDriver(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, db.DatabaseURL.String(), drv.databaseURL.String())
 	require.Equal(t, "schema_migrations", drv.migrationsTableName)
+
+	// driver operations can be canceled with a context
+	require.Implements(t, (*dbmate.ContextDriver)(nil), drv)
 }
 
 func TestConnectionString(t *testing.T) {
@@ -414,3 +420,62 @@ func TestMySQLQuotedMigrationsTableName(t *testing.T) {
 		require.Equal(t, "`fooMigrations`", name)
 	})
 }
+
+func TestMySQLSetTimeouts(t *testing.T) {
+	drv := testMySQLDriver(t)
+	db := prepTestMySQLDB(t)
+	defer dbutil.MustClose(db)
+
+	_, err := db.Exec("create table users (id int primary key)")
+	require.NoError(t, err)
+
+	sqlConn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer dbutil.MustClose(sqlConn)
+	conn := dbutil.Conn{Conn: sqlConn}
+
+	err = drv.SetTimeouts(context.Background(), conn, 50*time.Millisecond, 1500*time.Millisecond)
+	require.NoError(t, err)
+
+	value, err := dbutil.QueryValueContext(context.Background(), conn, "select @@session.max_execution_time")
+	require.NoError(t, err)
+	require.Equal(t, "50", value)
+	value, err = dbutil.QueryValueContext(context.Background(), conn, "select @@session.lock_wait_timeout")
+	require.NoError(t, err)
+	require.Equal(t, "2", value)
+
+	// exceeding the statement timeout returns a clear error
+	query := "select benchmark(1000000000, md5('dbmate'))"
+	_, err = conn.ExecContext(context.Background(), query)
+	require.Error(t, err)
+	err = drv.QueryError(query, err)
+	require.True(t, errors.Is(err, dbmate.ErrStatementTimeout))
+	require.Contains(t, err.Error(), "statement timeout exceeded: Error 3024")
+
+	// exceeding the lock timeout returns a clear error
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, tx.Rollback())
+	}()
+	_, err = tx.Exec("select * from users")
+	require.NoError(t, err)
+
+	query = "alter table users add column name text"
+	_, err = conn.ExecContext(context.Background(), query)
+	require.Error(t, err)
+	err = drv.QueryError(query, err)
+	require.True(t, errors.Is(err, dbmate.ErrLockTimeout))
+	require.Contains(t, err.Error(), "lock timeout exceeded: Error 1205")
+
+	// zero restores the server defaults
+	err = drv.SetTimeouts(context.Background(), conn, 0, 0)
+	require.NoError(t, err)
+
+	value, err = dbutil.QueryValueContext(context.Background(), conn, "select @@session.max_execution_time = @@global.max_execution_time")
+	require.NoError(t, err)
+	require.Equal(t, "1", value)
+	value, err = dbutil.QueryValueContext(context.Background(), conn, "select @@session.lock_wait_timeout = @@global.lock_wait_timeout")
+	require.NoError(t, err)
+	require.Equal(t, "1", value)
+}
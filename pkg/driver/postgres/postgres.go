@@ -2,13 +2,15 @@ package postgres
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/url"
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
@@ -25,7 +27,7 @@ func init() {
 type Driver struct {
 	migrationsTableName string
 	databaseURL         *url.URL
-	log                 io.Writer
+	logger              *slog.Logger
 }
 
 // NewDriver initializes the driver
@@ -33,7 +35,7 @@ func NewDriver(config dbmate.DriverConfig) dbmate.Driver {
 	return &Driver{
 		migrationsTableName: config.MigrationsTableName,
 		databaseURL:         config.DatabaseURL,
-		log:                 config.Log,
+		logger:              config.GetLogger(),
 	}
 }
 
@@ -123,8 +125,13 @@ func (drv *Driver) openPostgresDB() (*sql.DB, error) {
 
 // CreateDatabase creates the specified database
 func (drv *Driver) CreateDatabase() error {
+	return drv.CreateDatabaseContext(context.Background())
+}
+
+// CreateDatabaseContext creates the specified database
+func (drv *Driver) CreateDatabaseContext(ctx context.Context) error {
 	name := dbutil.DatabaseName(drv.databaseURL)
-	fmt.Fprintf(drv.log, "Creating: %s\n", name)
+	drv.logger.Info("Creating: "+name, dbmate.EventKey, dbmate.EventDatabaseCreate, "database", name)
 
 	db, err := drv.openPostgresDB()
 	if err != nil {
@@ -132,7 +139,7 @@ func (drv *Driver) CreateDatabase() error {
 	}
 	defer dbutil.MustClose(db)
 
-	_, err = db.Exec(fmt.Sprintf("create database %s",
+	_, err = db.ExecContext(ctx, fmt.Sprintf("create database %s",
 		pq.QuoteIdentifier(name)))
 
 	return err
@@ -140,8 +147,13 @@ func (drv *Driver) CreateDatabase() error {
 
 // DropDatabase drops the specified database (if it exists)
 func (drv *Driver) DropDatabase() error {
+	return drv.DropDatabaseContext(context.Background())
+}
+
+// DropDatabaseContext drops the specified database (if it exists)
+func (drv *Driver) DropDatabaseContext(ctx context.Context) error {
 	name := dbutil.DatabaseName(drv.databaseURL)
-	fmt.Fprintf(drv.log, "Dropping: %s\n", name)
+	drv.logger.Info("Dropping: "+name, dbmate.EventKey, dbmate.EventDatabaseDrop, "database", name)
 
 	db, err := drv.openPostgresDB()
 	if err != nil {
@@ -149,20 +161,20 @@ func (drv *Driver) DropDatabase() error {
 	}
 	defer dbutil.MustClose(db)
 
-	_, err = db.Exec(fmt.Sprintf("drop database if exists %s",
+	_, err = db.ExecContext(ctx, fmt.Sprintf("drop database if exists %s",
 		pq.QuoteIdentifier(name)))
 
 	return err
 }
 
-func (drv *Driver) schemaMigrationsDump(db *sql.DB) ([]byte, error) {
-	migrationsTable, err := drv.quotedMigrationsTableName(db)
+func (drv *Driver) schemaMigrationsDump(ctx context.Context, db *sql.DB) ([]byte, error) {
+	migrationsTable, err := drv.quotedMigrationsTableName(ctx, db)
 	if err != nil {
 		return nil, err
 	}
 
 	// load applied migrations
-	migrations, err := dbutil.QueryColumn(db,
+	migrations, err := dbutil.QueryColumnContext(ctx, db,
 		"select quote_literal(version) from "+migrationsTable+" order by version asc")
 	if err != nil {
 		return nil, err
@@ -183,15 +195,20 @@ func (drv *Driver) schemaMigrationsDump(db *sql.DB) ([]byte, error) {
 
 // DumpSchema returns the current database schema
 func (drv *Driver) DumpSchema(db *sql.DB) ([]byte, error) {
+	return drv.DumpSchemaContext(context.Background(), db)
+}
+
+// DumpSchemaContext returns the current database schema
+func (drv *Driver) DumpSchemaContext(ctx context.Context, db *sql.DB) ([]byte, error) {
 	// load schema
 	args := append([]string{"--format=plain", "--encoding=UTF8", "--schema-only",
 		"--no-privileges", "--no-owner"}, connectionArgsForDump(drv.databaseURL)...)
-	schema, err := dbutil.RunCommand("pg_dump", args...)
+	schema, err := dbutil.RunCommandContext(ctx, "pg_dump", args...)
 	if err != nil {
 		return nil, err
 	}
 
-	migrations, err := drv.schemaMigrationsDump(db)
+	migrations, err := drv.schemaMigrationsDump(ctx, db)
 	if err != nil {
 		return nil, err
 	}
@@ -202,6 +219,11 @@ func (drv *Driver) DumpSchema(db *sql.DB) ([]byte, error) {
 
 // DatabaseExists determines whether the database exists
 func (drv *Driver) DatabaseExists() (bool, error) {
+	return drv.DatabaseExistsContext(context.Background())
+}
+
+// DatabaseExistsContext determines whether the database exists
+func (drv *Driver) DatabaseExistsContext(ctx context.Context) (bool, error) {
 	name := dbutil.DatabaseName(drv.databaseURL)
 
 	db, err := drv.openPostgresDB()
@@ -211,7 +233,7 @@ func (drv *Driver) DatabaseExists() (bool, error) {
 	defer dbutil.MustClose(db)
 
 	exists := false
-	err = db.QueryRow("select true from pg_database where datname = $1", name).
+	err = db.QueryRowContext(ctx, "select true from pg_database where datname = $1", name).
 		Scan(&exists)
 	if err == sql.ErrNoRows {
 		return false, nil
@@ -222,14 +244,19 @@ func (drv *Driver) DatabaseExists() (bool, error) {
 
 // MigrationsTableExists checks if the schema_migrations table exists
 func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
-	schema, migrationsTableNameParts, err := drv.migrationsTableNameParts(db)
+	return drv.MigrationsTableExistsContext(context.Background(), db)
+}
+
+// MigrationsTableExistsContext checks if the schema_migrations table exists
+func (drv *Driver) MigrationsTableExistsContext(ctx context.Context, db *sql.DB) (bool, error) {
+	schema, migrationsTableNameParts, err := drv.migrationsTableNameParts(ctx, db)
 	if err != nil {
 		return false, err
 	}
 
 	migrationsTable := strings.Join(migrationsTableNameParts, ".")
 	exists := false
-	err = db.QueryRow("SELECT 1 FROM information_schema.tables "+
+	err = db.QueryRowContext(ctx, "SELECT 1 FROM information_schema.tables "+
 		"WHERE  table_schema = $1 "+
 		"AND    table_name   = $2",
 		schema, migrationsTable).
@@ -243,7 +270,12 @@ func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
 
 // CreateMigrationsTable creates the schema_migrations table
 func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
-	schema, migrationsTable, err := drv.quotedMigrationsTableNameParts(db)
+	return drv.CreateMigrationsTableContext(context.Background(), db)
+}
+
+// CreateMigrationsTableContext creates the schema_migrations table
+func (drv *Driver) CreateMigrationsTableContext(ctx context.Context, db *sql.DB) error {
+	schema, migrationsTable, err := drv.quotedMigrationsTableNameParts(ctx, db)
 	if err != nil {
 		return err
 	}
@@ -252,7 +284,7 @@ func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
 	createTableStmt := fmt.Sprintf(
 		"create table if not exists %s.%s (version varchar(128) primary key)",
 		schema, migrationsTable)
-	_, err = db.Exec(createTableStmt)
+	_, err = db.ExecContext(ctx, createTableStmt)
 	if err == nil {
 		// table exists or created successfully
 		return nil
@@ -267,21 +299,27 @@ func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
 
 	// in theory we could attempt to create the schema every time, but we avoid that
 	// in case the user doesn't have permissions to create schemas
-	fmt.Fprintf(drv.log, "Creating schema: %s\n", schema)
-	_, err = db.Exec(fmt.Sprintf("create schema if not exists %s", schema))
+	drv.logger.Info("Creating schema: "+schema, dbmate.EventKey, dbmate.EventSchemaCreate, "schema", schema)
+	_, err = db.ExecContext(ctx, fmt.Sprintf("create schema if not exists %s", schema))
 	if err != nil {
 		return err
 	}
 
 	// second and final attempt at creating migrations table
-	_, err = db.Exec(createTableStmt)
+	_, err = db.ExecContext(ctx, createTableStmt)
 	return err
 }
 
 // SelectMigrations returns a list of applied migrations
 // with an optional limit (in descending order)
 func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
-	migrationsTable, err := drv.quotedMigrationsTableName(db)
+	return drv.SelectMigrationsContext(context.Background(), db, limit)
+}
+
+// SelectMigrationsContext returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv *Driver) SelectMigrationsContext(ctx context.Context, db *sql.DB, limit int) (map[string]bool, error) {
+	migrationsTable, err := drv.quotedMigrationsTableName(ctx, db)
 	if err != nil {
 		return nil, err
 	}
@@ -290,7 +328,7 @@ func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, err
 	if limit >= 0 {
 		query = fmt.Sprintf("%s limit %d", query, limit)
 	}
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -316,24 +354,34 @@ func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, err
 
 // InsertMigration adds a new migration record
 func (drv *Driver) InsertMigration(db dbutil.Transaction, version string) error {
-	migrationsTable, err := drv.quotedMigrationsTableName(db)
+	return drv.InsertMigrationContext(context.Background(), db, version)
+}
+
+// InsertMigrationContext adds a new migration record
+func (drv *Driver) InsertMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	migrationsTable, err := drv.quotedMigrationsTableName(ctx, db)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec("insert into "+migrationsTable+" (version) values ($1)", version)
+	_, err = dbutil.ExecContext(ctx, db, "insert into "+migrationsTable+" (version) values ($1)", version)
 
 	return err
 }
 
 // DeleteMigration removes a migration record
 func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error {
-	migrationsTable, err := drv.quotedMigrationsTableName(db)
+	return drv.DeleteMigrationContext(context.Background(), db, version)
+}
+
+// DeleteMigrationContext removes a migration record
+func (drv *Driver) DeleteMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	migrationsTable, err := drv.quotedMigrationsTableName(ctx, db)
 	if err != nil {
 		return err
 	}
 
-	_, err = db.Exec("delete from "+migrationsTable+" where version = $1", version)
+	_, err = dbutil.ExecContext(ctx, db, "delete from "+migrationsTable+" where version = $1", version)
 
 	return err
 }
@@ -341,6 +389,12 @@ func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error
 // Ping verifies a connection to the database server. It does not verify whether the
 // specified database exists.
 func (drv *Driver) Ping() error {
+	return drv.PingContext(context.Background())
+}
+
+// PingContext verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv *Driver) PingContext(ctx context.Context) error {
 	// attempt connection to primary database, not "postgres" database
 	// to support servers with no "postgres" database
 	// (see https://github.com/amacneil/dbmate/issues/78)
@@ -350,7 +404,7 @@ func (drv *Driver) Ping() error {
 	}
 	defer dbutil.MustClose(db)
 
-	err = db.Ping()
+	err = db.PingContext(ctx)
 	if err == nil {
 		return nil
 	}
@@ -372,13 +426,47 @@ func (drv *Driver) QueryError(query string, err error) error {
 		if pos, err := strconv.Atoi(pqErr.Position); err == nil {
 			position = pos
 		}
+
+		switch pqErr.Code {
+		case "57014": // query_canceled
+			if strings.Contains(pqErr.Message, "statement timeout") {
+				err = fmt.Errorf("%w: %w", dbmate.ErrStatementTimeout, err)
+			}
+		case "55P03": // lock_not_available
+			err = fmt.Errorf("%w: %w", dbmate.ErrLockTimeout, err)
+		}
 	}
 
 	return &dbmate.QueryError{Err: err, Query: query, Position: position}
 }
 
-func (drv *Driver) quotedMigrationsTableName(db dbutil.Transaction) (string, error) {
-	schema, name, err := drv.quotedMigrationsTableNameParts(db)
+// SetTimeouts applies statement and lock timeouts. Within a transaction the timeouts
+// are scoped to that transaction, otherwise they apply to the current session.
+// A zero duration restores the server default.
+func (drv *Driver) SetTimeouts(ctx context.Context, db dbutil.Transaction, statementTimeout, lockTimeout time.Duration) error {
+	scope := "SESSION"
+	if _, ok := db.(*sql.Tx); ok {
+		scope = "LOCAL"
+	}
+
+	_, err := dbutil.ExecContext(ctx, db, fmt.Sprintf("SET %s statement_timeout TO %s; SET %s lock_timeout TO %s",
+		scope, timeoutValue(statementTimeout), scope, timeoutValue(lockTimeout)))
+
+	return err
+}
+
+// timeoutValue formats a duration as a postgres timeout setting in milliseconds
+func timeoutValue(d time.Duration) string {
+	if d <= 0 {
+		return "DEFAULT"
+	}
+
+	// round up so that sub-millisecond timeouts are not treated as disabled
+	return strconv.FormatInt(int64((d+time.Millisecond-1)/time.Millisecond), 10)
+}
+
+func (drv *Driver) quotedMigrationsTableName(ctx context.Context, db dbutil.Transaction) (string, error) {
+	schema, name, err := drv.quotedMigrationsTableNameParts(ctx, db)
 	if err != nil {
 		return "", err
 	}
@@ -386,7 +474,7 @@ func (drv *Driver) quotedMigrationsTableName(db dbutil.Transaction) (string, err
 	return schema + "." + name, nil
 }
 
-func (drv *Driver) migrationsTableNameParts(db dbutil.Transaction) (string, []string, error) {
+func (drv *Driver) migrationsTableNameParts(ctx context.Context, db dbutil.Transaction) (string, []string, error) {
 	schema := ""
 	tableNameParts := strings.Split(drv.migrationsTableName, ".")
 	if len(tableNameParts) > 1 {
@@ -404,7 +492,7 @@ func (drv *Driver) migrationsTableNameParts(db dbutil.Transaction) (string, []st
 	if schema == "" {
 		// if no URL available, use current schema
 		// this is a hack because we don't always have the URL context available
-		schema, err = dbutil.QueryValue(db, "select current_schema()")
+		schema, err = dbutil.QueryValueContext(ctx, db, "select current_schema()")
 		if err != nil {
 			return "", nil, err
 		}
@@ -418,8 +506,8 @@ func (drv *Driver) migrationsTableNameParts(db dbutil.Transaction) (string, []st
 	return schema, tableNameParts, nil
 }
 
-func (drv *Driver) quotedMigrationsTableNameParts(db dbutil.Transaction) (string, string, error) {
-	schema, tableNameParts, err := drv.migrationsTableNameParts(db)
+func (drv *Driver) quotedMigrationsTableNameParts(ctx context.Context, db dbutil.Transaction) (string, string, error) {
+	schema, tableNameParts, err := drv.migrationsTableNameParts(ctx, db)
 
 	if err != nil {
 		return "", "", err
@@ -429,7 +517,7 @@ func (drv *Driver) quotedMigrationsTableNameParts(db dbutil.Transaction) (string
 	// use server rather than client to do this to avoid unnecessary quotes
 	// (which would change schema.sql diff)
 	tableNameParts = append([]string{schema}, tableNameParts...)
-	quotedNameParts, err := dbutil.QueryColumn(db, "select quote_ident(unnest($1::text[]))", pq.Array(tableNameParts))
+	quotedNameParts, err := dbutil.QueryColumnContext(ctx, db, "select quote_ident(unnest($1::text[]))", pq.Array(tableNameParts))
 	if err != nil {
 		return "", "", err
 	}
@@ -1,11 +1,14 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"net/url"
 	"os"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
@@ -49,6 +52,9 @@ func TestGetDriver(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, db.DatabaseURL.String(), drv.databaseURL.String())
 	require.Equal(t, "schema_migrations", drv.migrationsTableName)
+
+	// driver operations can be canceled with a context
+	require.Implements(t, (*dbmate.ContextDriver)(nil), drv)
 }
 
 func defaultConnString() string {
@@ -461,13 +467,43 @@ func TestPostgresPing(t *testing.T) {
 	require.Contains(t, err.Error(), "connect: connection refused")
 }
 
+func TestPostgresSetTimeouts(t *testing.T) {
+	drv := testPostgresDriver(t)
+	db := prepTestPostgresDB(t)
+	defer dbutil.MustClose(db)
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, tx.Rollback())
+	}()
+
+	err = drv.SetTimeouts(context.Background(), tx, 50*time.Millisecond, 2*time.Second)
+	require.NoError(t, err)
+
+	value, err := dbutil.QueryValueContext(context.Background(), tx, "show statement_timeout")
+	require.NoError(t, err)
+	require.Equal(t, "50ms", value)
+	value, err = dbutil.QueryValueContext(context.Background(), tx, "show lock_timeout")
+	require.NoError(t, err)
+	require.Equal(t, "2s", value)
+
+	// exceeding the statement timeout returns a clear error
+	query := "select pg_sleep(1)"
+	_, err = tx.Exec(query)
+	require.Error(t, err)
+	err = drv.QueryError(query, err)
+	require.True(t, errors.Is(err, dbmate.ErrStatementTimeout))
+	require.Contains(t, err.Error(), "statement timeout exceeded: pq: canceling statement due to statement timeout")
+}
+
 func TestPostgresQuotedMigrationsTableName(t *testing.T) {
 	t.Run("default schema", func(t *testing.T) {
 		drv := testPostgresDriver(t)
 		db := prepTestPostgresDB(t)
 		defer dbutil.MustClose(db)
 
-		name, err := drv.quotedMigrationsTableName(db)
+		name, err := drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "public.schema_migrations", name)
 	})
@@ -487,7 +523,7 @@ func TestPostgresQuotedMigrationsTableName(t *testing.T) {
 		require.NoError(t, err)
 
 		// should use first schema from search path
-		name, err := drv.quotedMigrationsTableName(db)
+		name, err := drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "foo.schema_migrations", name)
 	})
@@ -502,7 +538,7 @@ func TestPostgresQuotedMigrationsTableName(t *testing.T) {
 		_, err := db.Exec("select pg_catalog.set_config('search_path', '', false)")
 		require.NoError(t, err)
 
-		name, err := drv.quotedMigrationsTableName(db)
+		name, err := drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "public.schema_migrations", name)
 	})
@@ -513,7 +549,7 @@ func TestPostgresQuotedMigrationsTableName(t *testing.T) {
 		defer dbutil.MustClose(db)
 
 		drv.migrationsTableName = "simple_name"
-		name, err := drv.quotedMigrationsTableName(db)
+		name, err := drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "public.simple_name", name)
 	})
@@ -525,7 +561,7 @@ func TestPostgresQuotedMigrationsTableName(t *testing.T) {
 
 		// this table name will need quoting
 		drv.migrationsTableName = "camelCase"
-		name, err := drv.quotedMigrationsTableName(db)
+		name, err := drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "public.\"camelCase\"", name)
 	})
@@ -543,7 +579,7 @@ func TestPostgresQuotedMigrationsTableName(t *testing.T) {
 		require.NoError(t, err)
 
 		drv.migrationsTableName = "simple_name"
-		name, err := drv.quotedMigrationsTableName(db)
+		name, err := drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "foo.simple_name", name)
 	})
@@ -564,19 +600,19 @@ func TestPostgresQuotedMigrationsTableName(t *testing.T) {
 
 		// if schema is specified as part of table name, it should override search_path
 		drv.migrationsTableName = "bar.simple_name"
-		name, err := drv.quotedMigrationsTableName(db)
+		name, err := drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "bar.simple_name", name)
 
 		// schema and table name should be quoted if necessary
 		drv.migrationsTableName = "barName.camelTable"
-		name, err = drv.quotedMigrationsTableName(db)
+		name, err = drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "\"barName\".\"camelTable\"", name)
 
 		// more than 2 components is unexpected but we will quote and pass it along anyway
 		drv.migrationsTableName = "whyWould.i.doThis"
-		name, err = drv.quotedMigrationsTableName(db)
+		name, err = drv.quotedMigrationsTableName(context.Background(), db)
 		require.NoError(t, err)
 		require.Equal(t, "\"whyWould\".i.\"doThis\"", name)
 	})
@@ -5,19 +5,22 @@ package sqlite
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"fmt"
-	"io"
+	"log/slog"
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
 
 	"github.com/lib/pq"
-	_ "github.com/mattn/go-sqlite3" // database/sql driver
+	"github.com/mattn/go-sqlite3"
 )
 
 func init() {
@@ -29,7 +32,7 @@ func init() {
 type Driver struct {
 	migrationsTableName string
 	databaseURL         *url.URL
-	log                 io.Writer
+	logger              *slog.Logger
 }
 
 // NewDriver initializes the driver
@@ -37,7 +40,7 @@ func NewDriver(config dbmate.DriverConfig) dbmate.Driver {
 	return &Driver{
 		migrationsTableName: config.MigrationsTableName,
 		databaseURL:         config.DatabaseURL,
-		log:                 config.Log,
+		logger:              config.GetLogger(),
 	}
 }
 
@@ -77,7 +80,13 @@ func (drv *Driver) Open() (*sql.DB, error) {
 
 // CreateDatabase creates the specified database
 func (drv *Driver) CreateDatabase() error {
-	fmt.Fprintf(drv.log, "Creating: %s\n", ConnectionString(drv.databaseURL))
+	return drv.CreateDatabaseContext(context.Background())
+}
+
+// CreateDatabaseContext creates the specified database
+func (drv *Driver) CreateDatabaseContext(ctx context.Context) error {
+	name := ConnectionString(drv.databaseURL)
+	drv.logger.Info("Creating: "+name, dbmate.EventKey, dbmate.EventDatabaseCreate, "database", name)
 
 	db, err := drv.Open()
 	if err != nil {
@@ -85,15 +94,20 @@ func (drv *Driver) CreateDatabase() error {
 	}
 	defer dbutil.MustClose(db)
 
-	return db.Ping()
+	return db.PingContext(ctx)
 }
 
 // DropDatabase drops the specified database (if it exists)
 func (drv *Driver) DropDatabase() error {
+	return drv.DropDatabaseContext(context.Background())
+}
+
+// DropDatabaseContext drops the specified database (if it exists)
+func (drv *Driver) DropDatabaseContext(ctx context.Context) error {
 	path := ConnectionString(drv.databaseURL)
-	fmt.Fprintf(drv.log, "Dropping: %s\n", path)
+	drv.logger.Info("Dropping: "+path, dbmate.EventKey, dbmate.EventDatabaseDrop, "database", path)
 
-	exists, err := drv.DatabaseExists()
+	exists, err := drv.DatabaseExistsContext(ctx)
 	if err != nil {
 		return err
 	}
@@ -104,11 +118,11 @@ func (drv *Driver) DropDatabase() error {
 	return os.Remove(path)
 }
 
-func (drv *Driver) schemaMigrationsDump(db *sql.DB) ([]byte, error) {
+func (drv *Driver) schemaMigrationsDump(ctx context.Context, db *sql.DB) ([]byte, error) {
 	migrationsTable := drv.quotedMigrationsTableName()
 
 	// load applied migrations
-	migrations, err := dbutil.QueryColumn(db,
+	migrations, err := dbutil.QueryColumnContext(ctx, db,
 		fmt.Sprintf("select quote(version) from %s order by version asc", migrationsTable))
 	if err != nil {
 		return nil, err
@@ -130,13 +144,18 @@ func (drv *Driver) schemaMigrationsDump(db *sql.DB) ([]byte, error) {
 
 // DumpSchema returns the current database schema
 func (drv *Driver) DumpSchema(db *sql.DB) ([]byte, error) {
+	return drv.DumpSchemaContext(context.Background(), db)
+}
+
+// DumpSchemaContext returns the current database schema
+func (drv *Driver) DumpSchemaContext(ctx context.Context, db *sql.DB) ([]byte, error) {
 	path := ConnectionString(drv.databaseURL)
-	schema, err := dbutil.RunCommand("sqlite3", path, ".schema --nosys")
+	schema, err := dbutil.RunCommandContext(ctx, "sqlite3", path, ".schema --nosys")
 	if err != nil {
 		return nil, err
 	}
 
-	migrations, err := drv.schemaMigrationsDump(db)
+	migrations, err := drv.schemaMigrationsDump(ctx, db)
 	if err != nil {
 		return nil, err
 	}
@@ -147,6 +166,11 @@ func (drv *Driver) DumpSchema(db *sql.DB) ([]byte, error) {
 
 // DatabaseExists determines whether the database exists
 func (drv *Driver) DatabaseExists() (bool, error) {
+	return drv.DatabaseExistsContext(context.Background())
+}
+
+// DatabaseExistsContext determines whether the database exists
+func (drv *Driver) DatabaseExistsContext(ctx context.Context) (bool, error) {
 	_, err := os.Stat(ConnectionString(drv.databaseURL))
 	if os.IsNotExist(err) {
 		return false, nil
@@ -160,8 +184,13 @@ func (drv *Driver) DatabaseExists() (bool, error) {
 
 // MigrationsTableExists checks if the schema_migrations table exists
 func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.MigrationsTableExistsContext(context.Background(), db)
+}
+
+// MigrationsTableExistsContext checks if the schema_migrations table exists
+func (drv *Driver) MigrationsTableExistsContext(ctx context.Context, db *sql.DB) (bool, error) {
 	exists := false
-	err := db.QueryRow("SELECT 1 FROM sqlite_master "+
+	err := db.QueryRowContext(ctx, "SELECT 1 FROM sqlite_master "+
 		"WHERE type='table' AND name=$1",
 		drv.migrationsTableName).
 		Scan(&exists)
@@ -174,7 +203,12 @@ func (drv *Driver) MigrationsTableExists(db *sql.DB) (bool, error) {
 
 // CreateMigrationsTable creates the schema migrations table
 func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec(fmt.Sprintf(
+	return drv.CreateMigrationsTableContext(context.Background(), db)
+}
+
+// CreateMigrationsTableContext creates the schema migrations table
+func (drv *Driver) CreateMigrationsTableContext(ctx context.Context, db *sql.DB) error {
+	_, err := db.ExecContext(ctx, fmt.Sprintf(
 		"create table if not exists %s (version varchar(128) primary key)",
 		drv.quotedMigrationsTableName()))
 
@@ -184,11 +218,17 @@ func (drv *Driver) CreateMigrationsTable(db *sql.DB) error {
 // SelectMigrations returns a list of applied migrations
 // with an optional limit (in descending order)
 func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.SelectMigrationsContext(context.Background(), db, limit)
+}
+
+// SelectMigrationsContext returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv *Driver) SelectMigrationsContext(ctx context.Context, db *sql.DB, limit int) (map[string]bool, error) {
 	query := fmt.Sprintf("select version from %s order by version desc", drv.quotedMigrationsTableName())
 	if limit >= 0 {
 		query = fmt.Sprintf("%s limit %d", query, limit)
 	}
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -214,7 +254,12 @@ func (drv *Driver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, err
 
 // InsertMigration adds a new migration record
 func (drv *Driver) InsertMigration(db dbutil.Transaction, version string) error {
-	_, err := db.Exec(
+	return drv.InsertMigrationContext(context.Background(), db, version)
+}
+
+// InsertMigrationContext adds a new migration record
+func (drv *Driver) InsertMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	_, err := dbutil.ExecContext(ctx, db,
 		fmt.Sprintf("insert into %s (version) values (?)", drv.quotedMigrationsTableName()),
 		version)
 
@@ -223,7 +268,12 @@ func (drv *Driver) InsertMigration(db dbutil.Transaction, version string) error
 
 // DeleteMigration removes a migration record
 func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error {
-	_, err := db.Exec(
+	return drv.DeleteMigrationContext(context.Background(), db, version)
+}
+
+// DeleteMigrationContext removes a migration record
+func (drv *Driver) DeleteMigrationContext(ctx context.Context, db dbutil.Transaction, version string) error {
+	_, err := dbutil.ExecContext(ctx, db,
 		fmt.Sprintf("delete from %s where version = ?", drv.quotedMigrationsTableName()),
 		version)
 
@@ -234,20 +284,59 @@ func (drv *Driver) DeleteMigration(db dbutil.Transaction, version string) error
 // testing whether the database is valid, it will automatically create the database
 // if it does not already exist.
 func (drv *Driver) Ping() error {
+	return drv.PingContext(context.Background())
+}
+
+// PingContext verifies a connection to the database. Due to the way SQLite works, by
+// testing whether the database is valid, it will automatically create the database
+// if it does not already exist.
+func (drv *Driver) PingContext(ctx context.Context) error {
 	db, err := drv.Open()
 	if err != nil {
 		return err
 	}
 	defer dbutil.MustClose(db)
 
-	return db.Ping()
+	return db.PingContext(ctx)
 }
 
 // Return a normalized version of the driver-specific error type.
 func (drv *Driver) QueryError(query string, err error) error {
+	if sqliteErr, ok := err.(sqlite3.Error); ok && sqliteErr.Code == sqlite3.ErrBusy {
+		err = fmt.Errorf("%w: %w", dbmate.ErrLockTimeout, err)
+	}
+
 	return &dbmate.QueryError{Err: err, Query: query}
 }
 
+// SetTimeouts applies the lock timeout as the connection busy timeout. SQLite has no
+// equivalent of a statement timeout, so statementTimeout is ignored.
+// A zero duration restores the busy timeout from the connection URL.
+func (drv *Driver) SetTimeouts(ctx context.Context, db dbutil.Transaction, _, lockTimeout time.Duration) error {
+	busyTimeout := drv.defaultBusyTimeout()
+	if lockTimeout > 0 {
+		// milliseconds, rounded up
+		busyTimeout = int64((lockTimeout + time.Millisecond - 1) / time.Millisecond)
+	}
+
+	_, err := dbutil.ExecContext(ctx, db, fmt.Sprintf("PRAGMA busy_timeout = %d", busyTimeout))
+
+	return err
+}
+
+// defaultBusyTimeout returns the busy timeout configured by go-sqlite3 when the
+// connection is opened, in milliseconds
+func (drv *Driver) defaultBusyTimeout() int64 {
+	query := drv.databaseURL.Query()
+	for _, key := range []string{"_busy_timeout", "_timeout"} {
+		if v, err := strconv.ParseInt(query.Get(key), 10, 64); err == nil {
+			return v
+		}
+	}
+
+	return 5000
+}
+
 func (drv *Driver) quotedMigrationsTableName() string {
 	return drv.quoteIdentifier(drv.migrationsTableName)
 }
@@ -4,13 +4,19 @@
 package sqlite
 
 import (
+	"bytes"
+	"context"
 	"database/sql"
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/amacneil/dbmate/v2/pkg/dbmate"
 	"github.com/amacneil/dbmate/v2/pkg/dbutil"
 
+	"github.com/mattn/go-sqlite3"
 	"github.com/stretchr/testify/require"
 )
 
@@ -50,6 +56,9 @@ func TestGetDriver(t *testing.T) {
 	require.True(t, ok)
 	require.Equal(t, db.DatabaseURL.String(), drv.databaseURL.String())
 	require.Equal(t, "schema_migrations", drv.migrationsTableName)
+
+	// driver operations can be canceled with a context
+	require.Implements(t, (*dbmate.ContextDriver)(nil), drv)
 }
 
 func TestConnectionString(t *testing.T) {
@@ -403,3 +412,54 @@ func TestSQLiteQuotedMigrationsTableName(t *testing.T) {
 		require.Equal(t, `"fooMigrations"`, name)
 	})
 }
+
+func TestSQLiteSetTimeouts(t *testing.T) {
+	drv := testSQLiteDriver(t)
+	db := prepTestSQLiteDB(t)
+	defer dbutil.MustClose(db)
+
+	require.Implements(t, (*dbmate.TimeoutDriver)(nil), drv)
+
+	// use a single connection so the pragma can be read back
+	db.SetMaxOpenConns(1)
+
+	err := drv.SetTimeouts(context.Background(), db, 0, 1500*time.Millisecond)
+	require.NoError(t, err)
+
+	value, err := dbutil.QueryValueContext(context.Background(), db, "pragma busy_timeout")
+	require.NoError(t, err)
+	require.Equal(t, "1500", value)
+
+	// zero restores the default
+	err = drv.SetTimeouts(context.Background(), db, 0, 0)
+	require.NoError(t, err)
+
+	value, err = dbutil.QueryValueContext(context.Background(), db, "pragma busy_timeout")
+	require.NoError(t, err)
+	require.Equal(t, "5000", value)
+}
+
+func TestSQLiteQueryError(t *testing.T) {
+	drv := testSQLiteDriver(t)
+
+	err := drv.QueryError("select 1", sqlite3.Error{Code: sqlite3.ErrBusy})
+	require.True(t, errors.Is(err, dbmate.ErrLockTimeout))
+
+	err = drv.QueryError("select 1", errors.New("syntax error"))
+	require.False(t, errors.Is(err, dbmate.ErrLockTimeout))
+	require.EqualError(t, err, "syntax error")
+}
+
+func TestSQLiteDriverConfigLog(t *testing.T) {
+	// drivers constructed without a Logger write messages to Log
+	path := filepath.Join(t.TempDir(), "app.sqlite3")
+	output := &bytes.Buffer{}
+	drv := NewDriver(dbmate.DriverConfig{
+		DatabaseURL: dbutil.MustParseURL("sqlite3:" + path),
+		Log:         output,
+	})
+
+	err := drv.CreateDatabase()
+	require.NoError(t, err)
+	require.Equal(t, "Creating: "+path+"\n", output.String())
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/amacneil/dbmate/v2/pkg/dbmate"
+)
+
+// statusServer periodically checks migration status, and exposes the result
+// as Prometheus metrics and a health check
+type statusServer struct {
+	db      *dbmate.DB
+	migrate bool
+
+	mu                    sync.RWMutex
+	summary               *dbmate.Summary
+	err                   error
+	lastCheck             time.Time
+	lastMigrationDuration time.Duration // only known for migrations applied by this server (--migrate)
+}
+
+func newStatusServer(db *dbmate.DB, migrate bool) *statusServer {
+	return &statusServer{db: db, migrate: migrate}
+}
+
+// check refreshes the migration status, applying any pending migrations first
+// if the server was started with --migrate
+func (s *statusServer) check(ctx context.Context) {
+	var migrationDuration time.Duration
+	summary, err := s.db.SummaryContext(ctx)
+	if err == nil && s.migrate && summary.Pending > 0 {
+		start := time.Now()
+		err = s.db.MigrateContext(ctx)
+		migrationDuration = time.Since(start)
+		if err == nil {
+			summary, err = s.db.SummaryContext(ctx)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastCheck = time.Now()
+	s.err = err
+	if err == nil {
+		s.summary = summary
+	}
+	if migrationDuration > 0 {
+		s.lastMigrationDuration = migrationDuration
+	}
+}
+
+// run checks migration status every interval until the context is canceled
+func (s *statusServer) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *statusServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", s.handleMetrics)
+	mux.HandleFunc("/healthz", s.handleHealthz)
+
+	return mux
+}
+
+// handleMetrics writes metrics in the Prometheus text exposition format
+func (s *statusServer) handleMetrics(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	up := 0
+	if s.err == nil && s.summary != nil {
+		up = 1
+	}
+	writeGauge(w, "dbmate_up", "Whether the last status check succeeded.", float64(up))
+	if !s.lastCheck.IsZero() {
+		writeGauge(w, "dbmate_last_check_timestamp_seconds", "Time of the last status check.", float64(s.lastCheck.Unix()))
+	}
+
+	if s.summary != nil {
+		writeGauge(w, "dbmate_migrations_applied", "Number of migration files applied to the database.", float64(s.summary.Applied))
+		writeGauge(w, "dbmate_migrations_pending", "Number of migration files not yet applied to the database.", float64(s.summary.Pending))
+		writeGauge(w, "dbmate_migrations_skipped", "Number of migration files which will not be applied to this database.", float64(s.summary.Skipped))
+		if version, err := strconv.ParseFloat(s.summary.LastApplied, 64); err == nil {
+			writeGauge(w, "dbmate_last_applied_version", "Highest migration version applied to the database.", version)
+		}
+
+		drift := 0
+		if s.summary.Drift() {
+			drift = 1
+		}
+		writeGauge(w, "dbmate_drift", "Whether applied migrations are missing files or pending migrations are out of order.", float64(drift))
+	}
+
+	// the database does not record how long migrations took, so this is only reported
+	// once the server has applied migrations itself
+	if s.lastMigrationDuration > 0 {
+		writeGauge(w, "dbmate_last_migration_duration_seconds", "Duration of the last migrate run.", s.lastMigrationDuration.Seconds())
+	}
+}
+
+// handleHealthz succeeds only when the last status check found no pending migrations
+func (s *statusServer) handleHealthz(w http.ResponseWriter, _ *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	switch {
+	case s.err != nil:
+		http.Error(w, fmt.Sprintf("error: %s", redactLogString(s.err.Error())), http.StatusServiceUnavailable)
+	case s.summary == nil:
+		http.Error(w, "status not yet checked", http.StatusServiceUnavailable)
+	case s.summary.Pending > 0:
+		http.Error(w, fmt.Sprintf("pending: %d", s.summary.Pending), http.StatusServiceUnavailable)
+	default:
+		_, _ = io.WriteString(w, "ok\n")
+	}
+}
+
+func writeGauge(w io.Writer, name, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %s\n", name, help, name, name,
+		strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// serve runs the status server on addr until the context is canceled
+func serve(ctx context.Context, db *dbmate.DB, addr string, interval time.Duration, migrate bool) error {
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be greater than 0, got %s", interval)
+	}
+
+	s := newStatusServer(db, migrate)
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s.handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	checkCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.run(checkCtx, interval)
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(shutdownCtx)
+	}()
+
+	if db.Logger != nil {
+		db.Logger.Info("Listening on "+addr, dbmate.EventKey, "serve", "addr", addr)
+	} else {
+		fmt.Fprintf(db.Log, "Listening on %s\n", addr)
+	}
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}